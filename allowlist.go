@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// appNetworkPolicyFile is the manifest, rendered from
+// templates/app-networkpolicy.yaml, restricting an app to its allowed CIDRs.
+const appNetworkPolicyFile = "networkpolicy.yaml"
+
+// allowlistLabel marks the pods of apps with their own allowed CIDRs, which
+// the namespace-wide policy of the local namespace leaves to the app's
+// NetworkPolicy.
+const allowlistLabel = "mcp-app-deployer/allowlist"
+
+// allowedCIDRsArg returns the optional allowed_cidrs argument in canonical
+// form, sorted and without duplicates. An empty list is returned as such, so
+// that an upgrade can clear the allowlist.
+func allowedCIDRsArg(args map[string]interface{}) ([]string, error) {
+	list, err := stringListArg(args, "allowed_cidrs")
+	if err != nil || list == nil {
+		return nil, err
+	}
+	return canonicalCIDRs("allowed_cidrs", list)
+}
+
+// canonicalCIDRs returns the CIDRs of the field name in canonical form,
+// sorted and without duplicates.
+func canonicalCIDRs(name string, list []string) ([]string, error) {
+	cidrs := make([]string, 0, len(list))
+	for _, s := range list {
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a valid CIDR", name, s)
+		}
+		if cidr := ipNet.String(); !slices.Contains(cidrs, cidr) {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	slices.Sort(cidrs)
+	return cidrs, nil
+}
+
+// checkLocalAllowlist fails if an app deployed in namespace would admit
+// networks outside --local-allowed-subnets through allowed CIDRs of its own.
+// Its pods leave the local namespace's policy for the app's NetworkPolicy,
+// so in the local namespace an allowlist may only narrow the local subnets.
+func (d *Deployer) checkLocalAllowlist(namespace string, cidrs []string) error {
+	if namespace != d.cfg.LocalNamespace {
+		return nil
+	}
+	for _, cidr := range cidrs {
+		if !cidrWithin(cidr, d.cfg.LocalAllowedSubnets) {
+			return fmt.Errorf("allowed_cidrs: %s is not within --local-allowed-subnets (%s); apps with exposure=local may only narrow the local subnets", cidr, listOrNone(d.cfg.LocalAllowedSubnets))
+		}
+	}
+	return nil
+}
+
+// cidrWithin reports whether cidr lies entirely within one of subnets.
+func cidrWithin(cidr string, subnets []string) bool {
+	_, inner, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false
+	}
+	innerOnes, innerBits := inner.Mask.Size()
+	for _, s := range subnets {
+		_, outer, err := net.ParseCIDR(s)
+		if err != nil {
+			continue
+		}
+		outerOnes, outerBits := outer.Mask.Size()
+		if outerBits == innerBits && outerOnes <= innerOnes && outer.Contains(inner.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// networkPolicyCIDRs returns the ipBlock CIDRs a rendered NetworkPolicy
+// admits.
+func networkPolicyCIDRs(raw []byte) []string {
+	var np networkingv1.NetworkPolicy
+	if yaml.Unmarshal(raw, &np) != nil {
+		return nil
+	}
+	return ipBlockCIDRs(&np)
+}
+
+// ipBlockCIDRs returns the ipBlock CIDRs a NetworkPolicy admits.
+func ipBlockCIDRs(np *networkingv1.NetworkPolicy) []string {
+	var cidrs []string
+	for _, rule := range np.Spec.Ingress {
+		for _, peer := range rule.From {
+			if peer.IPBlock != nil && !slices.Contains(cidrs, peer.IPBlock.CIDR) {
+				cidrs = append(cidrs, peer.IPBlock.CIDR)
+			}
+		}
+	}
+	return cidrs
+}
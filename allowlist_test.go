@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAllowedCIDRs(t *testing.T) {
+	h := newHarness(t)
+	h.d.cfg.AllowlistAnnotation = "nginx.ingress.kubernetes.io/whitelist-source-range"
+
+	out := h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "allowed_cidrs": []interface{}{"192.168.1.7"}}, true)
+	if !strings.Contains(out, "not a valid CIDR") {
+		t.Fatalf("unexpected error: %s", out)
+	}
+
+	h.call("deploy-image", map[string]interface{}{
+		"app_name":      "admin",
+		"image":         "nginx:1.27",
+		"exposure":      exposureLocal,
+		"allowed_cidrs": []interface{}{"192.168.1.7/32", "192.168.2.9/24", "192.168.1.7/32"},
+	}, false)
+	np := readRepoFile(t, h.d, "manifests/admin/networkpolicy.yaml")
+	for _, want := range []string{"name: admin-allowlist", "app: admin", "cidr: 192.168.2.0/24", "cidr: 192.168.1.7/32"} {
+		if !strings.Contains(np, want) {
+			t.Errorf("app NetworkPolicy lacks %q:\n%s", want, np)
+		}
+	}
+	if deployment := readRepoFile(t, h.d, "manifests/admin/deployment.yaml"); !strings.Contains(deployment, allowlistLabel+`: "true"`) {
+		t.Errorf("pods are not labelled out of the namespace policy:\n%s", deployment)
+	}
+	if ingress := readRepoFile(t, h.d, "manifests/admin/ingress.yaml"); !strings.Contains(ingress, `whitelist-source-range: "192.168.1.7/32,192.168.2.0/24"`) {
+		t.Errorf("ingress lacks the allowlist annotation:\n%s", ingress)
+	}
+	// The namespace default stays in place for other apps.
+	if ns := readRepoFile(t, h.d, "manifests/local-namespace-network-policy/networkpolicy.yaml"); !strings.Contains(ns, "operator: DoesNotExist") {
+		t.Errorf("namespace policy does not exclude allowlisted apps:\n%s", ns)
+	}
+
+	// In the local namespace an allowlist may only narrow the local subnets.
+	for _, cidrs := range [][]interface{}{{"0.0.0.0/0"}, {"192.168.1.0/24", "10.0.0.0/8"}, {"192.0.0.0/8"}} {
+		out = h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "exposure": exposureLocal, "mode": modeUpgrade, "allowed_cidrs": cidrs}, true)
+		if !strings.Contains(out, "is not within --local-allowed-subnets (192.168.0.0/16)") {
+			t.Fatalf("allowed_cidrs %v accepted in the local namespace: %s", cidrs, out)
+		}
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "open", "image": "nginx:1.27", "allowed_cidrs": []interface{}{"0.0.0.0/0"}}, false)
+	if out := h.call("set-exposure", map[string]interface{}{"app_name": "open", "exposure": exposureLocal}, true); !strings.Contains(out, "0.0.0.0/0 is not within --local-allowed-subnets") {
+		t.Fatalf("set-exposure moved an open allowlist into the local namespace: %s", out)
+	}
+
+	out = h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "ingress_annotations": map[string]interface{}{h.d.cfg.AllowlistAnnotation: "0.0.0.0/0"}, "exposure": exposureLocal, "mode": modeUpgrade}, true)
+	if !strings.Contains(out, "set by the deployer") {
+		t.Fatalf("allowlist annotation accepted in ingress_annotations: %s", out)
+	}
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.28", "exposure": exposureLocal, "mode": modeUpgrade}, false)
+	if np := readRepoFile(t, h.d, "manifests/admin/networkpolicy.yaml"); !strings.Contains(np, "cidr: 192.168.2.0/24") {
+		t.Fatalf("upgrade dropped the allowlist:\n%s", np)
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.28", "exposure": exposureLocal, "mode": modeUpgrade, "allowed_cidrs": []interface{}{}}, false)
+	if np := readRepoFile(t, h.d, "manifests/admin/networkpolicy.yaml"); np != "" {
+		t.Fatalf("allowed_cidrs=[] kept the NetworkPolicy:\n%s", np)
+	}
+	if deployment := readRepoFile(t, h.d, "manifests/admin/deployment.yaml"); strings.Contains(deployment, allowlistLabel) {
+		t.Fatalf("allowed_cidrs=[] kept the pod label:\n%s", deployment)
+	}
+
+	// Helm apps are restricted through the ingress controller only.
+	chart := map[string]interface{}{"app_name": "chart", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0", "allowed_cidrs": []interface{}{"198.51.100.0/24"}}
+	h.call("deploy-helmchart", chart, false)
+	if app := readRepoFile(t, h.d, "argocd-apps/chart.yaml"); !strings.Contains(app, `whitelist-source-range"`) || !strings.Contains(app, `value: "198.51.100.0/24"`) {
+		t.Fatalf("helm application lacks the allowlist:\n%s", app)
+	}
+	h.call("deploy-helmchart", map[string]interface{}{"app_name": "chart", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.10.0", "mode": modeUpgrade}, false)
+	if app := readRepoFile(t, h.d, "argocd-apps/chart.yaml"); !strings.Contains(app, `value: "198.51.100.0/24"`) {
+		t.Fatalf("helm upgrade dropped the allowlist:\n%s", app)
+	}
+	h.d.cfg.AllowlistAnnotation = ""
+	chart["app_name"] = "chart2"
+	if out := h.call("deploy-helmchart", chart, true); !strings.Contains(out, "--allowlist-annotation") {
+		t.Fatalf("unexpected error: %s", out)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Authentication methods of apps deployed with exposure=authenticated.
+const (
+	// authSSO sends visitors through the oauth2-proxy at --auth-url.
+	authSSO = "sso"
+	// authBasic asks for a generated user and password.
+	authBasic = "basic"
+)
+
+// authAnnotationPrefix prefixes the ingress-nginx annotations that put an
+// Ingress behind authentication. The deployer renders them itself.
+const authAnnotationPrefix = "nginx.ingress.kubernetes.io/auth-"
+
+// basicAuthFile is the manifest, rendered from
+// templates/basic-auth-secret.yaml, holding the htpasswd entry of an app with
+// auth=basic.
+const basicAuthFile = "basic-auth-secret.yaml"
+
+// authArg extracts the optional auth argument into req. It is only accepted
+// with exposure=authenticated; when it is not given, the method is decided by
+// authMethod.
+func (d *Deployer) authArg(args map[string]interface{}, req *deployRequest) error {
+	raw, ok := args["auth"]
+	if !ok || raw == nil {
+		return nil
+	}
+	auth, ok := raw.(string)
+	if !ok {
+		return fmt.Errorf("auth must be a string")
+	}
+	if req.Exposure != exposureAuthenticated {
+		return fmt.Errorf("auth only applies to exposure=%s", exposureAuthenticated)
+	}
+	switch auth {
+	case authSSO, authBasic:
+	default:
+		return fmt.Errorf("auth must be %q or %q", authSSO, authBasic)
+	}
+	if auth == authSSO && d.cfg.AuthURL == "" {
+		return fmt.Errorf("auth=%s requires the server to be started with --auth-url", authSSO)
+	}
+	req.Auth = auth
+	return nil
+}
+
+// authMethod returns how visitors of the app in req authenticate, or "" if
+// it is not deployed with exposure=authenticated. Without an auth argument,
+// apps use single sign-on when --auth-url is set and basic auth otherwise.
+func (d *Deployer) authMethod(req deployRequest) string {
+	switch {
+	case req.Exposure != exposureAuthenticated:
+		return ""
+	case req.Auth != "":
+		return req.Auth
+	case d.cfg.AuthURL != "":
+		return authSSO
+	}
+	return authBasic
+}
+
+// authAnnotations returns the Ingress annotations putting the app in req
+// behind its authentication method, in a new map the caller may add to.
+func (d *Deployer) authAnnotations(req deployRequest) (map[string]string, error) {
+	switch d.authMethod(req) {
+	case authSSO:
+		if d.cfg.AuthURL == "" {
+			return nil, fmt.Errorf("auth=%s requires the server to be started with --auth-url", authSSO)
+		}
+		annotations := map[string]string{authAnnotationPrefix + "url": d.cfg.AuthURL}
+		if d.cfg.AuthSigninURL != "" {
+			annotations[authAnnotationPrefix+"signin"] = d.cfg.AuthSigninURL
+		}
+		return annotations, nil
+	case authBasic:
+		return map[string]string{
+			authAnnotationPrefix + "type":   "basic",
+			authAnnotationPrefix + "secret": basicAuthSecretName(req.AppName),
+			authAnnotationPrefix + "realm":  "Authentication required",
+		}, nil
+	}
+	return map[string]string{}, nil
+}
+
+// authFromAnnotation returns the authentication method an Ingress annotation
+// shows, or "" if it shows none.
+func authFromAnnotation(key, value string) string {
+	switch {
+	case key == authAnnotationPrefix+"url":
+		return authSSO
+	case key == authAnnotationPrefix+"type" && value == "basic":
+		return authBasic
+	}
+	return ""
+}
+
+func basicAuthSecretName(appName string) string {
+	return appName + "-basic-auth"
+}
+
+// basicAuthUser is the user name of an app's basic auth.
+func basicAuthUser(appName string) string {
+	return appName
+}
+
+// newBasicAuth generates a password for appName's basic auth, and returns it
+// with the htpasswd entry holding its bcrypt hash. Only the hash is
+// committed; the password is shown once, in the deploy result.
+func newBasicAuth(appName string) (password, htpasswd string, err error) {
+	password = rand.Text()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", fmt.Errorf("hash basic auth password: %w", err)
+	}
+	return password, basicAuthUser(appName) + ":" + string(hash), nil
+}
+
+// basicAuthNotice tells the caller the credentials of a new basic auth.
+func basicAuthNotice(appName, password string) string {
+	return fmt.Sprintf("Basic auth user %s, password %s. Store it now: only its hash is kept in Git; redeploy with mode=%s to generate a new one.", basicAuthUser(appName), password, modeReplace)
+}
+
+// basicAuthHtpasswd returns the htpasswd entry of a rendered basic auth
+// Secret.
+func basicAuthHtpasswd(raw []byte) string {
+	var secret corev1.Secret
+	if yaml.Unmarshal(raw, &secret) != nil {
+		return ""
+	}
+	if auth, ok := secret.StringData["auth"]; ok {
+		return strings.TrimSpace(auth)
+	}
+	return strings.TrimSpace(string(secret.Data["auth"]))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticatedExposure(t *testing.T) {
+	h := newHarness(t)
+
+	out := h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "exposure": exposureAuthenticated, "auth": authSSO}, true)
+	if !strings.Contains(out, "--auth-url") {
+		t.Fatalf("unexpected error: %s", out)
+	}
+	out = h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "auth": authBasic}, true)
+	if !strings.Contains(out, "auth only applies to exposure=authenticated") {
+		t.Fatalf("unexpected error: %s", out)
+	}
+
+	// Without --auth-url, apps get basic auth with a generated password.
+	out = h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "exposure": exposureAuthenticated}, false)
+	m := regexp.MustCompile(`Basic auth user admin, password (\S+)\.`).FindStringSubmatch(out)
+	if m == nil {
+		t.Fatalf("deploy did not return the password: %s", out)
+	}
+	secret := readRepoFile(t, h.d, "manifests/admin/"+basicAuthFile)
+	htpasswd := basicAuthHtpasswd([]byte(secret))
+	user, hash, _ := strings.Cut(htpasswd, ":")
+	if user != "admin" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(m[1])) != nil {
+		t.Fatalf("secret does not hold the password's hash:\n%s", secret)
+	}
+	ingress := readRepoFile(t, h.d, "manifests/admin/ingress.yaml")
+	for _, want := range []string{`nginx.ingress.kubernetes.io/auth-type: "basic"`, `nginx.ingress.kubernetes.io/auth-secret: "admin-basic-auth"`} {
+		if !strings.Contains(ingress, want) {
+			t.Errorf("ingress lacks %q:\n%s", want, ingress)
+		}
+	}
+
+	out = h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "ingress_annotations": map[string]interface{}{"nginx.ingress.kubernetes.io/auth-type": "none"}, "mode": modeUpgrade}, true)
+	if !strings.Contains(out, "set by the deployer") {
+		t.Fatalf("auth annotation accepted in ingress_annotations: %s", out)
+	}
+
+	// An upgrade keeps the authentication and the password.
+	out = h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.28", "mode": modeUpgrade}, false)
+	if strings.Contains(out, "password") {
+		t.Fatalf("upgrade generated a new password: %s", out)
+	}
+	if got := readRepoFile(t, h.d, "manifests/admin/"+basicAuthFile); got != secret {
+		t.Fatalf("upgrade changed the basic auth secret:\n%s", got)
+	}
+
+	// Status counts a request for credentials as reachable for
+	// authenticated apps only.
+	h.call("deploy-image", map[string]interface{}{"app_name": "open", "image": "nginx:1.27"}, false)
+	h.d.httpClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody, Request: r}, nil
+	})}
+	if out := h.call("status", map[string]interface{}{"app_name": "admin"}, false); !strings.Contains(out, "✅ Ingress reachable") {
+		t.Fatalf("401 from an authenticated app is not reachable:\n%s", out)
+	}
+	if out := h.call("status", map[string]interface{}{"app_name": "open"}, false); !strings.Contains(out, "❌ Ingress unreachable") {
+		t.Fatalf("401 from a public app is reachable:\n%s", out)
+	}
+
+	// Exposing the app publicly removes the authentication.
+	h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.28", "exposure": exposurePublic, "mode": modeUpgrade}, false)
+	if got := readRepoFile(t, h.d, "manifests/admin/"+basicAuthFile); got != "" {
+		t.Fatalf("public exposure kept the basic auth secret:\n%s", got)
+	}
+	if ingress := readRepoFile(t, h.d, "manifests/admin/ingress.yaml"); strings.Contains(ingress, authAnnotationPrefix) {
+		t.Fatalf("public exposure kept the auth annotations:\n%s", ingress)
+	}
+
+	// With --auth-url, apps use single sign-on, which redirects to the
+	// sign-in page.
+	h.d.cfg.AuthURL = "https://auth.example.com/oauth2/auth"
+	h.d.cfg.AuthSigninURL = "https://auth.example.com/oauth2/start?rd=$scheme://$host$escaped_request_uri"
+	chart := map[string]interface{}{"app_name": "chart", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0", "exposure": exposureAuthenticated, "auth": authBasic}
+	if out := h.call("deploy-helmchart", chart, true); !strings.Contains(out, "not supported for Helm charts") {
+		t.Fatalf("unexpected error: %s", out)
+	}
+	delete(chart, "auth")
+	h.d.httpClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		header := http.Header{"Location": {"https://auth.example.com/oauth2/start?rd=" + r.URL.String()}}
+		return &http.Response{StatusCode: http.StatusFound, Header: header, Body: http.NoBody, Request: r}, nil
+	})}
+	h.call("deploy-helmchart", chart, false)
+	app := readRepoFile(t, h.d, "argocd-apps/chart.yaml")
+	for _, want := range []string{`ingress.annotations.nginx\\.ingress\\.kubernetes\\.io/auth-url"`, `value: "https://auth.example.com/oauth2/auth"`, `auth-signin"`} {
+		if !strings.Contains(app, want) {
+			t.Errorf("helm application lacks %q:\n%s", want, app)
+		}
+	}
+	if out := h.call("status", map[string]interface{}{"app_name": "chart"}, false); !strings.Contains(out, "✅ Ingress reachable") {
+		t.Fatalf("redirect to the sign-in page is not reachable:\n%s", out)
+	}
+}
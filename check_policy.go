@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// checkPolicy renders an image or Helm chart deployment exactly as
+// deploy-image or deploy-helmchart would and reports every policy violation,
+// without touching Git. Exactly one of image and chartRef is set.
+func (d *Deployer) checkPolicy(ctx context.Context, appName, image, chartRef, exposure, targetNamespace string) (*mcp.CallToolResult, error) {
+	owner := Ownership{Owner: callerFrom(ctx).Name}
+	var (
+		app       policyApp
+		files     []renderedFile
+		allowlist error
+		err       error
+	)
+	if image != "" {
+		imageRef, perr := parseImageReference(image)
+		if perr != nil {
+			return mcp.NewToolResultError(perr.Error()), nil
+		}
+		allowlist = d.policy.checkImage(imageRef)
+		app = imagePolicyApp(appName, exposure, targetNamespace, imageRef)
+		req := deployRequest{AppName: appName, Exposure: exposure, Namespace: targetNamespace}
+		if d.authMethod(req) == authBasic {
+			// The basic auth Secret is rendered with a throwaway password.
+			if _, req.BasicAuth, err = newBasicAuth(appName); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+		}
+		files, err = d.renderImageApp(req, image, owner)
+	} else {
+		chartSource, perr := parseOCIHelmChartRef(chartRef)
+		if perr != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid OCI chart reference: %v", perr)), nil
+		}
+		allowlist = d.policy.checkChart(chartSource)
+		app = helmPolicyApp(appName, exposure, targetNamespace, chartSource)
+		files, err = d.renderHelmApp(deployRequest{AppName: appName, Exposure: exposure, Namespace: targetNamespace}, chartSource, owner)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render %v", err)), nil
+	}
+
+	var violations []string
+	if allowlist != nil {
+		violations = append(violations, allowlist.Error())
+	}
+	for _, v := range d.policy.checkRules(app, files) {
+		violations = append(violations, v.Error())
+	}
+
+	what := app.Image
+	if app.Source == sourceHelm {
+		what = app.Chart
+	}
+	result := []string{fmt.Sprintf("Policy check for %s (%s, exposure=%s)", appName, what, exposure)}
+	if len(violations) == 0 {
+		result = append(result, "✅ No policy violations; the deployment would be allowed")
+	}
+	for _, v := range violations {
+		result = append(result, "❌ "+v)
+	}
+	return mcp.NewToolResultText(strings.Join(result, "\n")), nil
+}
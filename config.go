@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// envPrefix is prepended to the upper-cased flag name to form the
+// environment variable for a setting, e.g. --github-url becomes
+// MCP_DEPLOYER_GITHUB_URL.
+const envPrefix = "MCP_DEPLOYER_"
+
+// Config holds the server settings. Every field can be set from a YAML file
+// (--config), an MCP_DEPLOYER_* environment variable or a command line flag,
+// in increasing order of precedence. YAML keys match the flag names.
+type Config struct {
+	Kubeconfig          string        `yaml:"kubeconfig"`
+	Namespace           string        `yaml:"namespace"`
+	LocalNamespace      string        `yaml:"local-namespace"`
+	LocalAllowedSubnets stringList    `yaml:"local-allowed-subnets"`
+	Domain              string        `yaml:"domain"`
+	GitHubURL           string        `yaml:"github-url"`
+	GitHubToken         string        `yaml:"github-token"`
+	GitHubTokenFile     string        `yaml:"github-token-file"`
+	ArgoCDAppPath       string        `yaml:"argocd-path"`
+	ManifestPath        string        `yaml:"manifest-path"`
+	HTTPAddr            string        `yaml:"http"`
+	HTTPPassword        string        `yaml:"http-password"`
+	HTTPPasswordFile    string        `yaml:"http-password-file"`
+	HTTPUsersFile       string        `yaml:"http-users-file"`
+	HTTPEndpointPath    string        `yaml:"http-path"`
+	ShutdownGracePeriod time.Duration `yaml:"shutdown-grace-period"`
+	PolicyFile          string        `yaml:"policy-file"`
+	TemplatesDir        string        `yaml:"templates-dir"`
+	TLSIssuer           string        `yaml:"tls-issuer"`
+	IngressClass        string        `yaml:"ingress-class"`
+	AllowlistAnnotation string        `yaml:"allowlist-annotation"`
+	AuthURL             string        `yaml:"auth-url"`
+	AuthSigninURL       string        `yaml:"auth-signin-url"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Namespace:           "applications",
+		LocalNamespace:      "applications-local",
+		Domain:              "tykus.net",
+		ArgoCDAppPath:       "argocd-apps",
+		ManifestPath:        "manifests",
+		HTTPEndpointPath:    "/mcp",
+		ShutdownGracePeriod: 5 * time.Minute,
+	}
+}
+
+// registerFlags binds every setting to a flag on fs, using the current values
+// in cfg as defaults. configPath receives the --config flag.
+func registerFlags(fs *flag.FlagSet, cfg *Config, configPath *string) {
+	fs.StringVar(configPath, "config", "", "Path to a YAML config file (keys match flag names)")
+	fs.StringVar(&cfg.Kubeconfig, "kubeconfig", cfg.Kubeconfig, "Path to kubeconfig file")
+	fs.StringVar(&cfg.Namespace, "namespace", cfg.Namespace, "Kubernetes namespace for public applications")
+	fs.StringVar(&cfg.LocalNamespace, "local-namespace", cfg.LocalNamespace, "Kubernetes namespace for local applications")
+	fs.Var(&cfg.LocalAllowedSubnets, "local-allowed-subnets", "Comma-separated list of CIDR subnets permitted to reach local applications")
+	fs.StringVar(&cfg.Domain, "domain", cfg.Domain, "Base domain for ingress")
+	fs.StringVar(&cfg.GitHubURL, "github-url", cfg.GitHubURL, "GitHub URL (e.g., https://github.com/user/repo)")
+	fs.StringVar(&cfg.GitHubToken, "github-token", cfg.GitHubToken, "GitHub Personal Access Token (prefer --github-token-file or MCP_DEPLOYER_GITHUB_TOKEN)")
+	fs.StringVar(&cfg.GitHubTokenFile, "github-token-file", cfg.GitHubTokenFile, "Path to a file containing the GitHub Personal Access Token")
+	fs.StringVar(&cfg.ArgoCDAppPath, "argocd-path", cfg.ArgoCDAppPath, "Path in repo for ArgoCD apps")
+	fs.StringVar(&cfg.ManifestPath, "manifest-path", cfg.ManifestPath, "Path in repo for Kubernetes manifests")
+	fs.StringVar(&cfg.HTTPAddr, "http", cfg.HTTPAddr, "If set (e.g. \":8080\"), serve MCP over Streamable HTTP on this address instead of stdio")
+	fs.StringVar(&cfg.HTTPPassword, "http-password", cfg.HTTPPassword, "Bearer token required to access the HTTP endpoint (required when --http is set unless --http-users-file is; falls back to MCP_HTTP_PASSWORD env var). Callers using it are admins, or, with --http-users-file, the non-admin user shared-password")
+	fs.StringVar(&cfg.HTTPPasswordFile, "http-password-file", cfg.HTTPPasswordFile, "Path to a file containing the HTTP bearer token")
+	fs.StringVar(&cfg.HTTPUsersFile, "http-users-file", cfg.HTTPUsersFile, "Path to a YAML file with per-user bearer tokens; the user is recorded as the owner of the apps they deploy")
+	fs.StringVar(&cfg.HTTPEndpointPath, "http-path", cfg.HTTPEndpointPath, "URL path for the MCP HTTP endpoint")
+	fs.DurationVar(&cfg.ShutdownGracePeriod, "shutdown-grace-period", cfg.ShutdownGracePeriod, "How long to wait for in-flight tool calls to finish on SIGTERM/SIGINT before forcing the HTTP server to stop")
+	fs.StringVar(&cfg.PolicyFile, "policy-file", cfg.PolicyFile, "Path to a YAML policy file with image/chart allowlists and manifest rules")
+	fs.StringVar(&cfg.TLSIssuer, "tls-issuer", cfg.TLSIssuer, "cert-manager ClusterIssuer that issues TLS certificates for ingress hosts; when set, apps get TLS unless deployed with tls=false")
+	fs.StringVar(&cfg.IngressClass, "ingress-class", cfg.IngressClass, "IngressClass set as ingressClassName on every app's Ingress; empty uses the cluster's default class")
+	fs.StringVar(&cfg.AllowlistAnnotation, "allowlist-annotation", cfg.AllowlistAnnotation, "Ingress annotation the ingress controller reads a comma-separated source CIDR allowlist from, e.g. nginx.ingress.kubernetes.io/whitelist-source-range; when set, an app's allowed_cidrs are also rendered into it")
+	fs.StringVar(&cfg.AuthURL, "auth-url", cfg.AuthURL, "URL ingress-nginx checks the requests of apps with exposure=authenticated against, e.g. an oauth2-proxy's https://auth.example.com/oauth2/auth; when set, such apps use single sign-on unless deployed with auth=basic")
+	fs.StringVar(&cfg.AuthSigninURL, "auth-signin-url", cfg.AuthSigninURL, "URL unauthenticated visitors of apps with auth=sso are redirected to, e.g. https://auth.example.com/oauth2/start?rd=$scheme://$host$escaped_request_uri")
+	fs.StringVar(&cfg.TemplatesDir, "templates-dir", cfg.TemplatesDir, "Directory of manifest templates overriding the built-in ones; other *.yaml files in it are rendered for every image app")
+}
+
+// loadConfig parses args and merges the settings with precedence
+// flag > environment > config file > default, then resolves secret files and
+// validates the result. lookupEnv is os.LookupEnv outside of tests; a variable
+// that is set but empty overrides the config file.
+func loadConfig(args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	// First pass: find out which flags were given explicitly and where the
+	// config file lives. The values parsed here are re-applied last.
+	var cliConfigPath string
+	cli := flag.NewFlagSet("mcp-app-deployer", flag.ContinueOnError)
+	cliCfg := defaultConfig()
+	registerFlags(cli, &cliCfg, &cliConfigPath)
+	if err := cli.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := defaultConfig()
+	var configPath string
+	merged := flag.NewFlagSet("merged", flag.ContinueOnError)
+	registerFlags(merged, &cfg, &configPath)
+
+	if cliConfigPath == "" {
+		cliConfigPath, _ = lookupEnv(envPrefix + "CONFIG")
+	}
+	if cliConfigPath != "" {
+		if err := readConfigFile(cliConfigPath, &cfg); err != nil {
+			return Config{}, err
+		}
+		if err := overrideSecrets(merged, "config file "+cliConfigPath, func(name string) bool {
+			return merged.Lookup(name).Value.String() != ""
+		}); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// Each layer replaces a secret from the layers below together with its
+	// file, before its own values are applied.
+	if err := overrideSecrets(merged, "environment", func(name string) bool {
+		_, ok := lookupEnv(envName(name))
+		return ok
+	}); err != nil {
+		return Config{}, err
+	}
+	var errs []error
+	merged.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		if v, ok := lookupEnv(envName(f.Name)); ok {
+			if err := merged.Set(f.Name, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", envName(f.Name), err))
+			}
+		}
+	})
+
+	given := map[string]bool{}
+	cli.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if err := overrideSecrets(merged, "command line", func(name string) bool {
+		return given[name]
+	}); err != nil {
+		return Config{}, err
+	}
+	cli.Visit(func(f *flag.Flag) {
+		if err := merged.Set(f.Name, f.Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("--%s: %w", f.Name, err))
+		}
+	})
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+
+	// Kept for backwards compatibility with deployments that predate the
+	// MCP_DEPLOYER_ prefix. Only the HTTP server uses the password.
+	if cfg.HTTPAddr != "" && cfg.HTTPPassword == "" && cfg.HTTPPasswordFile == "" {
+		if v, ok := lookupEnv("MCP_HTTP_PASSWORD"); ok {
+			cfg.HTTPPassword = v
+		}
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func readConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// secretSettings may each be given directly or, as <name>-file, read from a
+// file.
+var secretSettings = []string{"github-token", "http-password"}
+
+// overrideSecrets makes a secret given in a configuration layer replace both
+// its settings from the layers below, so that e.g. --github-token wins over
+// github-token-file in the config file. given reports whether the layer sets
+// a setting; setting both a secret and its file in one layer is an error.
+func overrideSecrets(merged *flag.FlagSet, layer string, given func(name string) bool) error {
+	for _, name := range secretSettings {
+		value, file := given(name), given(name+"-file")
+		switch {
+		case value && file:
+			return fmt.Errorf("%s: only one of %s and %s-file may be set", layer, name, name)
+		case value:
+			merged.Set(name+"-file", "")
+		case file:
+			merged.Set(name, "")
+		}
+	}
+	return nil
+}
+
+// resolveSecrets reads secrets supplied as *-file settings so they never have
+// to appear on the command line. overrideSecrets has left at most one of
+// each pair set.
+func (c *Config) resolveSecrets() error {
+	secrets := []struct {
+		name  string
+		value *string
+		file  string
+	}{
+		{"github-token", &c.GitHubToken, c.GitHubTokenFile},
+		{"http-password", &c.HTTPPassword, c.HTTPPasswordFile},
+	}
+	for _, s := range secrets {
+		if s.file == "" {
+			continue
+		}
+		raw, err := os.ReadFile(s.file)
+		if err != nil {
+			return fmt.Errorf("read %s-file: %w", s.name, err)
+		}
+		*s.value = strings.TrimSpace(string(raw))
+		if *s.value == "" {
+			return fmt.Errorf("%s-file %s is empty", s.name, s.file)
+		}
+	}
+	return nil
+}
+
+// isLocalRemote reports whether remote names a repository on the local
+// filesystem, as an absolute path or a file:// URL, which needs no token.
+func isLocalRemote(remote string) bool {
+	return filepath.IsAbs(remote) || strings.HasPrefix(remote, "file://")
+}
+
+func (c *Config) validate() error {
+	var errs []error
+	if c.Kubeconfig == "" {
+		errs = append(errs, errors.New("kubeconfig is required"))
+	}
+	local := isLocalRemote(c.GitHubURL)
+	if c.GitHubURL == "" {
+		errs = append(errs, errors.New("github-url is required"))
+	} else if u, err := url.Parse(c.GitHubURL); !local && (err != nil || u.Scheme == "" || u.Host == "") {
+		errs = append(errs, fmt.Errorf("github-url %q is neither an absolute URL nor a local path", c.GitHubURL))
+	}
+	if c.GitHubToken == "" && !local {
+		errs = append(errs, errors.New("github-token (or github-token-file) is required"))
+	}
+	if c.Namespace == "" {
+		errs = append(errs, errors.New("namespace must not be empty"))
+	}
+	if c.LocalNamespace == "" {
+		errs = append(errs, errors.New("local-namespace must not be empty"))
+	}
+	if c.Namespace != "" && c.Namespace == c.LocalNamespace {
+		errs = append(errs, fmt.Errorf("namespace and local-namespace must differ (both %q)", c.Namespace))
+	}
+	if c.Domain == "" {
+		errs = append(errs, errors.New("domain must not be empty"))
+	}
+	if c.ArgoCDAppPath == "" {
+		errs = append(errs, errors.New("argocd-path must not be empty"))
+	}
+	if c.ManifestPath == "" {
+		errs = append(errs, errors.New("manifest-path must not be empty"))
+	}
+	for _, subnet := range c.LocalAllowedSubnets {
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			errs = append(errs, fmt.Errorf("local-allowed-subnets: %q is not a valid CIDR", subnet))
+		}
+	}
+	if c.HTTPAddr != "" {
+		if c.HTTPPassword == "" && c.HTTPUsersFile == "" {
+			errs = append(errs, errors.New("http-password (or http-password-file, or MCP_HTTP_PASSWORD) or http-users-file is required when http is set"))
+		}
+		if !strings.HasPrefix(c.HTTPEndpointPath, "/") {
+			errs = append(errs, fmt.Errorf("http-path %q must start with /", c.HTTPEndpointPath))
+		}
+	}
+	if c.TLSIssuer != "" {
+		for _, m := range validation.IsDNS1123Subdomain(c.TLSIssuer) {
+			errs = append(errs, fmt.Errorf("tls-issuer %q is invalid: %s", c.TLSIssuer, m))
+		}
+	}
+	if c.IngressClass != "" {
+		for _, m := range validation.IsDNS1123Subdomain(c.IngressClass) {
+			errs = append(errs, fmt.Errorf("ingress-class %q is invalid: %s", c.IngressClass, m))
+		}
+	}
+	if c.AllowlistAnnotation != "" {
+		for _, m := range validation.IsQualifiedName(c.AllowlistAnnotation) {
+			errs = append(errs, fmt.Errorf("allowlist-annotation %q is invalid: %s", c.AllowlistAnnotation, m))
+		}
+	}
+	for _, setting := range []struct{ name, value string }{{"auth-url", c.AuthURL}, {"auth-signin-url", c.AuthSigninURL}} {
+		if setting.value == "" {
+			continue
+		}
+		if u, err := url.Parse(setting.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s %q is not an absolute http(s) URL", setting.name, setting.value))
+		}
+	}
+	if c.AuthSigninURL != "" && c.AuthURL == "" {
+		errs = append(errs, errors.New("auth-signin-url requires auth-url"))
+	}
+	if c.ShutdownGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("shutdown-grace-period must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// stringList is a list setting given as a comma-separated string on the
+// command line and in environment variables, or as a YAML sequence in the
+// config file.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, p := range strings.Split(value, ",") {
+		if s := strings.TrimSpace(p); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+func (l *stringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return l.Set(node.Value)
+	}
+	var items []string
+	if err := node.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, configFile, `
+kubeconfig: /from/file
+github-url: https://github.com/file/repo
+github-token: file-token
+namespace: file-ns
+domain: file.example.com
+allowlist-annotation: from-file
+local-allowed-subnets:
+  - 10.0.0.0/8
+  - 192.168.0.0/16
+`)
+
+	env := map[string]string{
+		"MCP_DEPLOYER_NAMESPACE": "env-ns",
+		"MCP_DEPLOYER_DOMAIN":    "env.example.com",
+		// Set but empty still overrides the config file.
+		"MCP_DEPLOYER_ALLOWLIST_ANNOTATION": "",
+	}
+	args := []string{"--config", configFile, "--domain", "flag.example.com"}
+
+	cfg, err := loadConfig(args, envFrom(env))
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+
+	checks := map[string][2]string{
+		"kubeconfig":     {cfg.Kubeconfig, "/from/file"},
+		"namespace":      {cfg.Namespace, "env-ns"},
+		"domain":         {cfg.Domain, "flag.example.com"},
+		"localNamespace": {cfg.LocalNamespace, "applications-local"},
+		"subnets":        {cfg.LocalAllowedSubnets.String(), "10.0.0.0/8,192.168.0.0/16"},
+		"annotation":     {cfg.AllowlistAnnotation, ""},
+	}
+	for name, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s: got %q want %q", name, c[0], c[1])
+		}
+	}
+}
+
+func TestLoadConfigLegacyHTTPPassword(t *testing.T) {
+	base := []string{"--kubeconfig", "/kube", "--github-url", "https://github.com/a/b", "--github-token", "t"}
+	env := envFrom(map[string]string{"MCP_HTTP_PASSWORD": "legacy"})
+
+	cfg, err := loadConfig(base, env)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.HTTPPassword != "" {
+		t.Fatalf("HTTPPassword = %q without --http, want it unset", cfg.HTTPPassword)
+	}
+
+	cfg, err = loadConfig(append(base, "--http", ":8080"), env)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.HTTPPassword != "legacy" {
+		t.Fatalf("HTTPPassword = %q, want %q", cfg.HTTPPassword, "legacy")
+	}
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	writeFile(t, tokenFile, "secret-token\n")
+
+	base := []string{"--kubeconfig", "/kube", "--github-url", "https://github.com/a/b"}
+
+	cfg, err := loadConfig(append(base, "--github-token-file", tokenFile), noEnv)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.GitHubToken != "secret-token" {
+		t.Fatalf("GitHubToken = %q, want %q", cfg.GitHubToken, "secret-token")
+	}
+
+	_, err = loadConfig(append(base, "--github-token-file", tokenFile, "--github-token", "x"), noEnv)
+	if err == nil || !strings.Contains(err.Error(), "only one of github-token and github-token-file") {
+		t.Fatalf("expected mutually exclusive error, got %v", err)
+	}
+
+	// A token from a higher layer replaces a token file from a lower one.
+	configFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, configFile, "github-token-file: "+tokenFile+"\n")
+	withFile := append(base, "--config", configFile)
+	for name, c := range map[string]struct {
+		args []string
+		env  map[string]string
+		want string
+	}{
+		"flag over file": {append(withFile, "--github-token", "flag-token"), nil, "flag-token"},
+		"env over file":  {withFile, map[string]string{"MCP_DEPLOYER_GITHUB_TOKEN": "env-token"}, "env-token"},
+		"flag over env":  {append(base, "--github-token", "flag-token"), map[string]string{"MCP_DEPLOYER_GITHUB_TOKEN_FILE": tokenFile}, "flag-token"},
+		"file from env":  {append(base, "--config", configFile), map[string]string{"MCP_DEPLOYER_GITHUB_TOKEN_FILE": tokenFile}, "secret-token"},
+	} {
+		cfg, err := loadConfig(c.args, envFrom(c.env))
+		if err != nil {
+			t.Errorf("%s: loadConfig returned error: %v", name, err)
+		} else if cfg.GitHubToken != c.want {
+			t.Errorf("%s: GitHubToken = %q, want %q", name, cfg.GitHubToken, c.want)
+		}
+	}
+
+	_, err = loadConfig(base, envFrom(map[string]string{"MCP_DEPLOYER_GITHUB_TOKEN": "x", "MCP_DEPLOYER_GITHUB_TOKEN_FILE": tokenFile}))
+	if err == nil || !strings.Contains(err.Error(), "environment: only one of github-token and github-token-file") {
+		t.Fatalf("expected mutually exclusive error for the environment, got %v", err)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.yaml")
+	writeFile(t, configFile, "githubToken: typo\n")
+
+	_, err := loadConfig([]string{"--config", configFile}, noEnv)
+	if err == nil || !strings.Contains(err.Error(), "githubToken") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+
+	_, err = loadConfig([]string{"--local-allowed-subnets", "10.0.0.0/33", "--http", ":8080"}, noEnv)
+	if err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+	for _, want := range []string{"kubeconfig is required", "github-url is required", "github-token", `"10.0.0.0/33" is not a valid CIDR`, "http-password"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("validation error missing %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigLocalRemote(t *testing.T) {
+	for _, remote := range []string{"file:///srv/gitops.git", "/srv/gitops.git"} {
+		cfg, err := loadConfig([]string{"--kubeconfig", "/kube", "--github-url", remote}, noEnv)
+		if err != nil {
+			t.Errorf("%s: loadConfig returned error: %v", remote, err)
+		} else if cfg.GitHubURL != remote {
+			t.Errorf("GitHubURL = %q, want %q", cfg.GitHubURL, remote)
+		}
+	}
+
+	_, err := loadConfig([]string{"--kubeconfig", "/kube", "--github-url", "gitops.git"}, noEnv)
+	if err == nil || !strings.Contains(err.Error(), "neither an absolute URL nor a local path") || !strings.Contains(err.Error(), "github-token") {
+		t.Fatalf("expected relative remote and missing token errors, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// envFrom looks environment variables up in env, like os.LookupEnv.
+func envFrom(env map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+}
+
+func noEnv(string) (string, bool) { return "", false }
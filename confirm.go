@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// confirmations hands out short-lived, single-use tokens for destructive
+// operations. The first call of a tool returns a plan and a token; only a
+// second call presenting that token for the same action carries it out, so a
+// single mistaken call never deletes anything.
+type confirmations struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+type pendingConfirmation struct {
+	action  string
+	expires time.Time
+}
+
+func newConfirmations(ttl time.Duration) *confirmations {
+	return &confirmations{ttl: ttl, now: time.Now, pending: map[string]pendingConfirmation{}}
+}
+
+// issue returns a new token confirming action, e.g. "destroy demo".
+func (c *confirmations) issue(action string) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for t, p := range c.pending {
+		if now.After(p.expires) {
+			delete(c.pending, t)
+		}
+	}
+	c.pending[token] = pendingConfirmation{action: action, expires: now.Add(c.ttl)}
+	return token, nil
+}
+
+// redeem consumes token if it was issued for action and has not expired.
+func (c *confirmations) redeem(token, action string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[token]
+	if !ok {
+		return errors.New("confirmation token is unknown or was already used; call again without confirm_token to get a new plan")
+	}
+	if p.action != action {
+		return errors.New("confirmation token was issued for a different operation (" + p.action + ")")
+	}
+	delete(c.pending, token)
+	if c.now().After(p.expires) {
+		return errors.New("confirmation token has expired; call again without confirm_token to get a new plan")
+	}
+	return nil
+}
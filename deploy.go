@@ -2,222 +2,288 @@ package main
 
 import (
 	"context"
-	"embed"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"text/template"
-	"time"
-
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-//go:embed templates/*
-var templatesFS embed.FS
+// deployRequest holds the arguments shared by deploy-image and
+// deploy-helmchart.
+type deployRequest struct {
+	AppName   string
+	Exposure  string
+	Namespace string
+	// Mode is one of modeCreate (the default when empty), modeUpgrade and
+	// modeReplace.
+	Mode string
+	// Protected sets or clears protection; nil keeps the current state.
+	Protected *bool
+	DryRun    bool
+
+	// Profile and Parameters select the template bundle deploy-image renders
+	// and its parameters; an empty Profile is defaultProfile, or on an
+	// upgrade the app's current profile. Nil Parameters
+	// on an upgrade keep those the app was deployed with.
+	Profile    string
+	Parameters map[string]interface{}
+
+	// TLS requests (true) or refuses (false) a certificate for the app's
+	// Ingress; nil uses the server default, on when --tls-issuer is set, or
+	// on an upgrade keeps the app's current setting.
+	TLS *bool
+
+	// Aliases are hostnames served besides <app>.<domain>, and Path the
+	// prefix routed to the app on every host ("/" when empty).
+	// IngressAnnotations are added to the Ingress. On an upgrade, nil (or an
+	// empty Path) keeps what the app was deployed with.
+	Aliases            []string
+	Path               string
+	IngressAnnotations map[string]string
+
+	// AllowedCIDRs restrict the app to these source networks instead of its
+	// namespace's default; on an upgrade, nil keeps the current ones.
+	AllowedCIDRs []string
+
+	// ExposureGiven is whether the exposure argument was given; an upgrade
+	// without it keeps an app authenticated, or without an Ingress.
+	ExposureGiven bool
+	// Auth is authSSO or authBasic for exposure=authenticated; empty leaves
+	// the choice to authMethod. BasicAuth is the htpasswd entry an upgrade
+	// keeps from the existing app.
+	Auth      string
+	BasicAuth string
+
+	// Egress restricts where the app's pods may connect to; on an upgrade,
+	// nil keeps the current restrictions.
+	Egress *EgressPolicy
+}
 
-func deploy(ctx context.Context, appName, image, exposure, targetNamespace string) (*mcp.CallToolResult, error) {
-	// 1. Clone the repository
-	tempDir, err := os.MkdirTemp("", "mcp-deployer-")
+func (d *Deployer) deploy(ctx context.Context, req deployRequest, image string) (*mcp.CallToolResult, error) {
+	imageRef, err := parseImageReference(image)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create temp dir: %v", err)), nil
-	}
-	defer os.RemoveAll(tempDir)
-
-	auth := &http.BasicAuth{
-		Username: "oauth2", // Common for tokens
-		Password: githubToken,
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	repo, err := git.PlainClone(tempDir, false, &git.CloneOptions{
-		URL:  githubURL,
-		Auth: auth,
+	commitMsg := fmt.Sprintf("Deploy application %s with image %s", req.AppName, image)
+	done := fmt.Sprintf("Successfully deployed %s. Git updated.", req.AppName)
+	// A basic auth password is generated when the app has none yet, and
+	// reported once it is committed.
+	var password string
+	res, err := d.deployWorkload(ctx, req, sourceImage, imageRef, commitMsg, done, func(req deployRequest, owner Ownership) ([]renderedFile, error) {
+		if d.authMethod(req) == authBasic && req.BasicAuth == "" {
+			var err error
+			if password, req.BasicAuth, err = newBasicAuth(req.AppName); err != nil {
+				return nil, err
+			}
+		}
+		return d.renderImageApp(req, image, owner)
 	})
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to clone repo: %v", err)), nil
+	if password != "" && !req.DryRun && err == nil && !res.IsError {
+		res = mcp.NewToolResultText(done + "\n" + basicAuthNotice(req.AppName, password))
 	}
+	return res, err
+}
 
-	w, err := repo.Worktree()
+// deployWorkload commits the manifests rendered by render for an app running
+// imageRef, after checking req against the existing app and the policy
+// rules, and reports done. It is shared by the tools deploying Git-sourced
+// apps of each source type.
+func (d *Deployer) deployWorkload(ctx context.Context, req deployRequest, source string, imageRef *imageReference, commitMsg, done string, render func(deployRequest, Ownership) ([]renderedFile, error)) (*mcp.CallToolResult, error) {
+	// 1. Clone the repository
+	ws, err := d.checkout(ctx)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get worktree: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
 	}
+	defer ws.close()
 
-	// 2. Prepare paths
-	appManifestPath := filepath.Join(tempDir, manifestPath, appName)
-	if err := os.MkdirAll(appManifestPath, 0755); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create manifest dir: %v", err)), nil
+	owner, err := d.prepareDeploy(ws, callerFrom(ctx), &req, source)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
-
-	argocdPath := filepath.Join(tempDir, argocdAppPath)
-	if err := os.MkdirAll(argocdPath, 0755); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create argocd app dir: %v", err)), nil
+	if err := d.checkLocalAllowlist(req.Namespace, req.AllowedCIDRs); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	// 3. Render templates
-	data := ImageManifestData{
-		Name:         appName,
-		Image:        image,
-		Namespace:    targetNamespace,
-		Domain:       domain,
-		RepoURL:      githubURL,
-		ManifestPath: manifestPath,
+	// 2. Render templates, write them merged with manual edits and check the
+	// result against the policy rules
+	files, err := render(req, owner)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render %v", err)), nil
 	}
-
-	// Render Kubernetes Manifests
-	manifests := []string{"deployment.yaml", "service.yaml", "ingress.yaml"}
-	for _, tmplName := range manifests {
-		tmpl, err := template.ParseFS(templatesFS, "templates/"+tmplName)
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to parse template %s: %v", tmplName, err)), nil
-		}
-
-		f, err := os.Create(filepath.Join(appManifestPath, tmplName))
-		if err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to create file %s: %v", tmplName, err)), nil
-		}
-		defer f.Close()
-
-		if err := tmpl.Execute(f, data); err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to execute template %s: %v", tmplName, err)), nil
-		}
-
-		if _, err := w.Add(filepath.Join(manifestPath, appName, tmplName)); err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to git add %s: %v", tmplName, err)), nil
-		}
+	if err := d.checkRoutes(ws, callerFrom(ctx), req.AppName, renderedRoutes(files)); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	argoData := ArgoApplicationData{
-		Name:      appName,
-		Namespace: targetNamespace,
-		Git: &ArgoGitSource{
-			RepoURL:        githubURL,
-			TargetRevision: "HEAD",
-			Path:           filepath.ToSlash(filepath.Join(manifestPath, appName)),
-		},
+	written, err := ws.writeGenerated(req.AppName, files)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to write manifest: %v", err)), nil
 	}
-
-	if err := writeArgoApplication(tempDir, w, argocdPath, "templates/application.yaml", argoData); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to render argo app: %v", err)), nil
+	app := imagePolicyApp(req.AppName, req.Exposure, req.Namespace, imageRef)
+	app.Source = source
+	if err := d.policy.enforceRules(app, written); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	if exposure == exposureLocal {
-		if err := ensureLocalNamespaceNetworkPolicy(tempDir, w, targetNamespace); err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to render local network policy: %v", err)), nil
-		}
+	if err := d.reconcileLocalNetworkPolicy(ws); err != nil && (req.Exposure == exposureLocal || !errors.Is(err, errLocalSubnetsUnset)) {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render local network policy: %v", err)), nil
 	}
 
-	// 4. Commit and Push
-	status, err := w.Status()
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get git status: %v", err)), nil
+	if req.DryRun {
+		return dryRunResult(ws, "deploying "+req.AppName)
 	}
 
-	if status.IsClean() {
+	// 3. Commit and Push
+	if err := d.commitAndPush(ctx, ws, commitMsg); err == errNoChanges {
 		return mcp.NewToolResultText("No changes to deploy"), nil
+	} else if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
 	}
 
-	commitMsg := fmt.Sprintf("Deploy application %s with image %s", appName, image)
-	_, err = w.Commit(commitMsg, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "MCP App Deployer",
-			Email: "mcp-deployer@bot.local",
-			When:  time.Now(),
-		},
-	})
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to commit changes: %v", err)), nil
-	}
-
-	if err := repo.Push(&git.PushOptions{Auth: auth}); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to push changes: %v", err)), nil
-	}
+	return mcp.NewToolResultText(done), nil
+}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully deployed %s. Git updated.", appName)), nil
+// renderedFile is a rendered manifest and the repository path it belongs at.
+type renderedFile struct {
+	path string
+	*manifest
 }
 
-// ensureLocalNamespaceNetworkPolicy writes a NetworkPolicy manifest and an
-// ArgoCD Application that deploys it into the local namespace, restricting
-// ingress to the configured subnets. The files are idempotent: rewriting them
-// with the same content produces no git diff.
-func ensureLocalNamespaceNetworkPolicy(tempDir string, w *git.Worktree, localNs string) error {
-	subnets := allowedSubnets()
-	if len(subnets) == 0 {
-		return fmt.Errorf("--local-allowed-subnets must be set to deploy applications with exposure=local")
+// renderImageApp renders the manifests of req.Profile for an image
+// deployment, plus any extra templates from --templates-dir and the app's
+// NetworkPolicies if it has allowed CIDRs or restricted egress and basic auth
+// Secret if it has auth=basic, together with the ArgoCD Application that
+// syncs them. With exposure=none the Ingress is left out.
+func (d *Deployer) renderImageApp(req deployRequest, image string, owner Ownership) ([]renderedFile, error) {
+	appName, targetNamespace, profile, params := req.AppName, req.Namespace, req.Profile, req.Parameters
+	if profile == "" {
+		profile = defaultProfile
 	}
-
-	bootstrapName := "local-namespace-network-policy"
-	npDir := filepath.Join(manifestPath, bootstrapName)
-	npDirAbs := filepath.Join(tempDir, npDir)
-	if err := os.MkdirAll(npDirAbs, 0755); err != nil {
-		return fmt.Errorf("create network policy dir: %w", err)
+	p, ok := d.profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(profileNames(d.profiles), ", "))
 	}
-
-	tmpl, err := template.ParseFS(templatesFS, "templates/networkpolicy.yaml")
+	effective, err := p.params(params)
 	if err != nil {
-		return fmt.Errorf("parse networkpolicy template: %w", err)
+		return nil, err
 	}
 
-	npFile := filepath.Join(npDirAbs, "networkpolicy.yaml")
-	f, err := os.Create(npFile)
+	issuer, err := d.tlsIssuer(req)
 	if err != nil {
-		return fmt.Errorf("create networkpolicy file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
+	annotations, err := d.authAnnotations(req)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(annotations, req.IngressAnnotations)
 
-	npData := struct {
-		Namespace      string
-		AllowedSubnets []string
-	}{Namespace: localNs, AllowedSubnets: subnets}
+	data := ImageManifestData{
+		Ownership:    owner,
+		Name:         appName,
+		Image:        image,
+		Namespace:    targetNamespace,
+		Domain:       d.cfg.Domain,
+		RepoURL:      d.repo.URL(),
+		ManifestPath: d.cfg.ManifestPath,
+		Profile:      profile,
+		Params:       effective,
+		TLSIssuer:    issuer,
+		IngressClass: d.cfg.IngressClass,
+
+		Aliases:            req.Aliases,
+		Path:               req.Path,
+		IngressAnnotations: annotations,
+
+		AllowedCIDRs:        req.AllowedCIDRs,
+		AllowlistAnnotation: d.cfg.AllowlistAnnotation,
+		BasicAuth:           req.BasicAuth,
+	}
 
-	if err := tmpl.Execute(f, npData); err != nil {
-		return fmt.Errorf("execute networkpolicy template: %w", err)
+	templates := slices.Clone(p.templates)
+	for _, name := range d.extraTemplates {
+		templates = append(templates, "templates/"+name)
 	}
 
-	if _, err := w.Add(filepath.ToSlash(filepath.Join(npDir, "networkpolicy.yaml"))); err != nil {
-		return fmt.Errorf("git add networkpolicy: %w", err)
+	appManifestPath := path.Join(d.cfg.ManifestPath, appName)
+	var files []renderedFile
+	for _, tmplPath := range templates {
+		tmplName := path.Base(tmplPath)
+		if req.Exposure == exposureNone && tmplName == "ingress.yaml" {
+			continue
+		}
+		m, err := renderManifest(d.templates, tmplPath, data)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", tmplName, err)
+		}
+		files = append(files, renderedFile{path: path.Join(appManifestPath, tmplName), manifest: m})
+	}
+	if len(req.AllowedCIDRs) > 0 {
+		m, err := renderManifest(d.templates, "templates/app-networkpolicy.yaml", data)
+		if err != nil {
+			return nil, fmt.Errorf("template app-networkpolicy.yaml: %w", err)
+		}
+		files = append(files, renderedFile{path: path.Join(appManifestPath, appNetworkPolicyFile), manifest: m})
+	}
+	egress, err := d.renderEgressPolicy(req, owner)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, egress...)
+	if d.authMethod(req) == authBasic {
+		if req.BasicAuth == "" {
+			return nil, fmt.Errorf("basic auth for %s has no htpasswd entry", appName)
+		}
+		m, err := renderManifest(d.templates, "templates/basic-auth-secret.yaml", data)
+		if err != nil {
+			return nil, fmt.Errorf("template basic-auth-secret.yaml: %w", err)
+		}
+		files = append(files, renderedFile{path: path.Join(appManifestPath, basicAuthFile), manifest: m})
 	}
 
 	argoData := ArgoApplicationData{
-		Name:      bootstrapName,
-		Namespace: localNs,
+		Ownership: owner,
+		Name:      appName,
+		Namespace: targetNamespace,
 		Git: &ArgoGitSource{
-			RepoURL:        githubURL,
+			RepoURL:        d.repo.URL(),
 			TargetRevision: "HEAD",
-			Path:           filepath.ToSlash(npDir),
+			Path:           appManifestPath,
 		},
 	}
-
-	argocdPath := filepath.Join(tempDir, argocdAppPath)
-	return writeArgoApplication(tempDir, w, argocdPath, "templates/application.yaml", argoData)
-}
-
-func writeArgoApplication(tempDir string, w *git.Worktree, argocdPath string, templatePath string, data ArgoApplicationData) error {
-	tmpl, err := template.ParseFS(templatesFS, templatePath)
-	if err != nil {
-		return fmt.Errorf("parse application template: %w", err)
-	}
-
-	argoAppFile := filepath.Join(argocdPath, data.Name+".yaml")
-	f, err := os.Create(argoAppFile)
-	if err != nil {
-		return fmt.Errorf("create argo app file: %w", err)
+	// The profile and the parameters as given are recorded so that upgrades
+	// can keep them; the default profile without parameters is left implicit.
+	if profile != defaultProfile || len(params) > 0 {
+		argoData.Profile = profile
 	}
-	defer f.Close()
-
-	if err := tmpl.Execute(f, data); err != nil {
-		return fmt.Errorf("execute application template: %w", err)
+	if len(params) > 0 {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("parameters: %w", err)
+		}
+		argoData.Parameters = string(raw)
 	}
-
-	relativeAppFile, err := filepath.Rel(tempDir, argoAppFile)
+	app, err := d.renderArgoApplication("templates/application.yaml", argoData)
 	if err != nil {
-		return fmt.Errorf("compute argo app path: %w", err)
+		return nil, err
 	}
+	return append(files, app), nil
+}
 
-	if _, err := w.Add(filepath.ToSlash(relativeAppFile)); err != nil {
-		return fmt.Errorf("git add argo app: %w", err)
+func (d *Deployer) renderArgoApplication(templatePath string, data ArgoApplicationData) (renderedFile, error) {
+	m, err := renderManifest(d.templates, templatePath, data)
+	if err != nil {
+		return renderedFile{}, fmt.Errorf("render application template: %w", err)
 	}
+	return renderedFile{path: d.argoAppFile(data.Name), manifest: m}, nil
+}
 
-	return nil
+// argoAppFile is the repository path of an app's ArgoCD Application.
+func (d *Deployer) argoAppFile(appName string) string {
+	return path.Join(d.cfg.ArgoCDAppPath, appName+".yaml")
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+// jobSpec holds the arguments of deploy-cronjob and run-job that are not in
+// deployRequest. Schedule and the history limits only apply to CronJobs,
+// BackoffLimit only to Jobs.
+type jobSpec struct {
+	Command                    []string
+	Schedule                   string
+	ConcurrencyPolicy          string
+	SuccessfulJobsHistoryLimit int
+	FailedJobsHistoryLimit     int
+	BackoffLimit               int
+}
+
+// concurrencyPolicies are the values accepted for a CronJob's
+// concurrency_policy.
+var concurrencyPolicies = []string{
+	string(batchv1.AllowConcurrent),
+	string(batchv1.ForbidConcurrent),
+	string(batchv1.ReplaceConcurrent),
+}
+
+// deployCronJob commits a CronJob running image on spec.Schedule, together
+// with the ArgoCD Application that syncs it.
+func (d *Deployer) deployCronJob(ctx context.Context, req deployRequest, image string, spec jobSpec) (*mcp.CallToolResult, error) {
+	imageRef, err := parseImageReference(image)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := validateSchedule(spec.Schedule); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	commitMsg := fmt.Sprintf("Deploy CronJob %s with image %s on schedule %q", req.AppName, image, spec.Schedule)
+	done := fmt.Sprintf("Successfully deployed CronJob %s with schedule %q. Git updated.", req.AppName, spec.Schedule)
+	return d.deployWorkload(ctx, req, sourceCronJob, imageRef, commitMsg, done, func(req deployRequest, owner Ownership) ([]renderedFile, error) {
+		return d.renderJobApp(req, sourceCronJob, image, spec, owner)
+	})
+}
+
+// runJob commits a one-off Job running image. Every call renders a new run-at
+// annotation, so calling it again for an existing Job with mode=upgrade makes
+// ArgoCD recreate the Job and run it again.
+func (d *Deployer) runJob(ctx context.Context, req deployRequest, image string, spec jobSpec) (*mcp.CallToolResult, error) {
+	imageRef, err := parseImageReference(image)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	commitMsg := fmt.Sprintf("Run Job %s with image %s", req.AppName, image)
+	done := fmt.Sprintf("Job %s committed; ArgoCD starts it on its next sync. Use status to follow it.", req.AppName)
+	return d.deployWorkload(ctx, req, sourceJob, imageRef, commitMsg, done, func(req deployRequest, owner Ownership) ([]renderedFile, error) {
+		return d.renderJobApp(req, sourceJob, image, spec, owner)
+	})
+}
+
+// renderJobApp renders the CronJob (sourceCronJob) or Job (sourceJob) of an
+// app and its egress NetworkPolicy, if it has one, together with the ArgoCD
+// Application that syncs them.
+func (d *Deployer) renderJobApp(req deployRequest, source, image string, spec jobSpec, owner Ownership) ([]renderedFile, error) {
+	data := JobManifestData{
+		Ownership:                  owner,
+		Name:                       req.AppName,
+		Image:                      image,
+		Namespace:                  req.Namespace,
+		Command:                    spec.Command,
+		Schedule:                   spec.Schedule,
+		ConcurrencyPolicy:          spec.ConcurrencyPolicy,
+		SuccessfulJobsHistoryLimit: spec.SuccessfulJobsHistoryLimit,
+		FailedJobsHistoryLimit:     spec.FailedJobsHistoryLimit,
+		BackoffLimit:               spec.BackoffLimit,
+		RunAt:                      time.Now().UTC().Format(time.RFC3339),
+	}
+
+	tmplName := workloadFiles[source]
+	m, err := renderManifest(d.templates, "templates/"+tmplName, data)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", tmplName, err)
+	}
+	appManifestPath := path.Join(d.cfg.ManifestPath, req.AppName)
+	files := []renderedFile{{path: path.Join(appManifestPath, tmplName), manifest: m}}
+	egress, err := d.renderEgressPolicy(req, owner)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, egress...)
+
+	app, err := d.renderArgoApplication("templates/application.yaml", ArgoApplicationData{
+		Ownership: owner,
+		Name:      req.AppName,
+		Namespace: req.Namespace,
+		Git: &ArgoGitSource{
+			RepoURL:        d.repo.URL(),
+			TargetRevision: "HEAD",
+			Path:           appManifestPath,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(files, app), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeployCronJobAndRunJob(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	h.call("deploy-cronjob", map[string]interface{}{"app_name": "backup", "image": "backup:1.0", "schedule": "every night"}, true)
+	for _, arg := range []map[string]interface{}{{"exposure": exposureLocal}, {"tls": true}, {"hosts": []interface{}{"backup.example.org"}}} {
+		args := map[string]interface{}{"app_name": "backup", "image": "backup:1.0", "schedule": "@daily"}
+		maps.Copy(args, arg)
+		if out := h.call("deploy-cronjob", args, true); !strings.Contains(out, "not supported for CronJobs and Jobs") {
+			t.Fatalf("unexpected result for %v: %s", arg, out)
+		}
+	}
+	if out := h.call("run-job", map[string]interface{}{"app_name": "migrate", "image": "migrate:1.0", "path": "/"}, true); !strings.Contains(out, "path is not supported") {
+		t.Fatalf("unexpected run-job result: %s", out)
+	}
+	h.call("deploy-cronjob", map[string]interface{}{
+		"app_name":           "backup",
+		"image":              "backup:1.0",
+		"schedule":           "0 3 * * *",
+		"command":            []interface{}{"/bin/backup", "--all"},
+		"concurrency_policy": "Forbid",
+	}, false)
+	cronJob := readRepoFile(t, h.d, "manifests/backup/cronjob.yaml")
+	for _, want := range []string{`schedule: "0 3 * * *"`, "concurrencyPolicy: Forbid", "successfulJobsHistoryLimit: 3", `- "--all"`} {
+		if !strings.Contains(cronJob, want) {
+			t.Fatalf("cronjob manifest missing %q:\n%s", want, cronJob)
+		}
+	}
+	out := h.call("deploy-cronjob", map[string]interface{}{"app_name": "backup", "image": "backup:1.1", "schedule": "@daily"}, true)
+	if !strings.Contains(out, "CronJob with image backup:1.0") {
+		t.Fatalf("existing cronjob not described: %s", out)
+	}
+	h.call("deploy-cronjob", map[string]interface{}{"app_name": "backup", "image": "backup:1.1", "schedule": "@daily", "mode": modeUpgrade}, false)
+	h.call("deploy-image", map[string]interface{}{"app_name": "backup", "image": "nginx:1.27", "mode": modeUpgrade}, true)
+	if out := h.call("set-exposure", map[string]interface{}{"app_name": "backup", "exposure": exposureLocal}, true); !strings.Contains(out, "is a CronJob, which always runs in namespace applications") {
+		t.Fatalf("unexpected set-exposure result: %s", out)
+	}
+
+	// Status reports the schedule and the outcome of recent Jobs.
+	hourAgo := metav1.NewTime(time.Now().Add(-time.Hour))
+	batch := h.d.kube.BatchV1().CronJobs(h.d.cfg.Namespace)
+	if _, err := batch.Create(ctx, &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Name: "backup", Namespace: h.d.cfg.Namespace},
+		Spec:       batchv1.CronJobSpec{Schedule: "@daily"},
+		Status:     batchv1.CronJobStatus{LastScheduleTime: &hourAgo, LastSuccessfulTime: &hourAgo},
+	}, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for i, job := range []batchv1.Job{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-1", CreationTimestamp: metav1.NewTime(hourAgo.Add(-24 * time.Hour))},
+			Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", LastTransitionTime: hourAgo},
+			}},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-2", CreationTimestamp: hourAgo},
+			Status: batchv1.JobStatus{CompletionTime: &hourAgo, Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			}},
+		},
+	} {
+		job.Namespace = h.d.cfg.Namespace
+		job.Labels = map[string]string{"app": "backup"}
+		if _, err := h.d.kube.BatchV1().Jobs(h.d.cfg.Namespace).Create(ctx, &job, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create job %d: %v", i, err)
+		}
+	}
+	out = h.call("status", map[string]interface{}{"app_name": "backup"}, false)
+	for _, want := range []string{
+		`✅ CronJob schedule "@daily"`,
+		"Last successful run: " + hourAgo.UTC().Format(time.RFC3339),
+		"Recent jobs:\n  ✅ backup-2 succeeded",
+		"  ❌ backup-1 failed",
+		"BackoffLimitExceeded",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("status missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Ingress") {
+		t.Fatalf("status probed the cronjob's ingress:\n%s", out)
+	}
+
+	// run-job runs again on every upgrade.
+	h.call("run-job", map[string]interface{}{"app_name": "migrate", "image": "app:2.0", "command": []interface{}{"/bin/migrate", "up"}, "backoff_limit": 0.0}, false)
+	job := readRepoFile(t, h.d, "manifests/migrate/job.yaml")
+	if !strings.Contains(job, "backoffLimit: 0") || !strings.Contains(job, "Replace=true") {
+		t.Fatalf("unexpected job manifest:\n%s", job)
+	}
+	if out := h.call("status", map[string]interface{}{"app_name": "migrate"}, false); !strings.Contains(out, "⏳ Job not created yet") {
+		t.Fatalf("unexpected job status:\n%s", out)
+	}
+	time.Sleep(time.Second) // run-at has a resolution of one second
+	h.call("run-job", map[string]interface{}{"app_name": "migrate", "image": "app:2.0", "mode": modeUpgrade}, false)
+	if rerun := readRepoFile(t, h.d, "manifests/migrate/job.yaml"); rerun == job {
+		t.Fatal("rerunning the job did not change it")
+	}
+	h.call("run-job", map[string]interface{}{"app_name": "migrate", "image": "app:2.0", "backoff_limit": 1.5}, true)
+}
@@ -2,112 +2,122 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"maps"
 	"strings"
-	"time"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-func deployHelmChart(ctx context.Context, appName, chartRef, exposure, targetNamespace string) (*mcp.CallToolResult, error) {
+func (d *Deployer) deployHelmChart(ctx context.Context, req deployRequest, chartRef string) (*mcp.CallToolResult, error) {
 	chartSource, err := parseOCIHelmChartRef(chartRef)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Invalid OCI chart reference: %v", err)), nil
 	}
 
-	host := fmt.Sprintf("%s.%s", appName, domain)
-
-	tempDir, err := os.MkdirTemp("", "mcp-helm-deployer-")
+	ws, err := d.checkout(ctx)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create temp dir: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
 	}
-	defer os.RemoveAll(tempDir)
+	defer ws.close()
 
-	auth := &http.BasicAuth{
-		Username: "oauth2",
-		Password: githubToken,
+	owner, err := d.prepareDeploy(ws, callerFrom(ctx), &req, sourceHelm)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := d.checkLocalAllowlist(req.Namespace, req.AllowedCIDRs); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	repo, err := git.PlainClone(tempDir, false, &git.CloneOptions{
-		URL:  githubURL,
-		Auth: auth,
-	})
+	files, err := d.renderHelmApp(req, chartSource, owner)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to clone repo: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render argo app: %v", err)), nil
+	}
+	if err := d.checkRoutes(ws, callerFrom(ctx), req.AppName, renderedRoutes(files)); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	w, err := repo.Worktree()
+	written, err := ws.writeGenerated(req.AppName, files)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get worktree: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to write argo app: %v", err)), nil
 	}
-
-	argocdPath := filepath.Join(tempDir, argocdAppPath)
-	if err := os.MkdirAll(argocdPath, 0755); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create argocd app dir: %v", err)), nil
+	if err := d.policy.enforceRules(helmPolicyApp(req.AppName, req.Exposure, req.Namespace, chartSource), written); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	argoData := ArgoApplicationData{
-		Name:      appName,
-		Namespace: targetNamespace,
-		Helm: &ArgoHelmSource{
-			RepoURL:        chartSource.RepoURL,
-			Chart:          chartSource.Chart,
-			TargetRevision: chartSource.TargetRevision,
-			ReleaseName:    appName,
-			IngressName:    appName,
-			IngressHost:    host,
-		},
+	if err := d.reconcileLocalNetworkPolicy(ws); err != nil && (req.Exposure == exposureLocal || !errors.Is(err, errLocalSubnetsUnset)) {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render local network policy: %v", err)), nil
 	}
 
-	if err := writeArgoApplication(tempDir, w, argocdPath, "templates/application-helm.yaml", argoData); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to render argo app: %v", err)), nil
+	if req.DryRun {
+		return dryRunResult(ws, "deploying "+req.AppName)
 	}
 
-	if exposure == exposureLocal {
-		if err := ensureLocalNamespaceNetworkPolicy(tempDir, w, targetNamespace); err != nil {
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to render local network policy: %v", err)), nil
-		}
+	commitMsg := fmt.Sprintf("Deploy application %s with Helm chart %s", req.AppName, chartRef)
+	if err := d.commitAndPush(ctx, ws, commitMsg); err == errNoChanges {
+		return mcp.NewToolResultText("No changes to deploy"), nil
+	} else if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
 	}
 
-	status, err := w.Status()
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get git status: %v", err)), nil
+	if err := d.waitForArgoApplicationHealthy(ctx, req.AppName, d.argoTimeout, d.pollInterval); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Git updated but ArgoCD did not become ready: %v", err)), nil
 	}
 
-	if status.IsClean() {
-		return mcp.NewToolResultText("No changes to deploy"), nil
+	host := d.appHost(req.AppName)
+	if err := d.waitForIngressReachability(ctx, host, d.authMethod(req) != "", d.ingressTimeout, d.pollInterval); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("ArgoCD synced %s but ingress did not become reachable: %v", req.AppName, err)), nil
 	}
 
-	commitMsg := fmt.Sprintf("Deploy application %s with Helm chart %s", appName, chartRef)
-	_, err = w.Commit(commitMsg, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "MCP App Deployer",
-			Email: "mcp-deployer@bot.local",
-			When:  time.Now(),
-		},
-	})
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully deployed %s from Helm chart %s. ArgoCD is synced and %s is reachable.", req.AppName, chartRef, host)), nil
+}
+
+// renderHelmApp renders the ArgoCD Application installing an OCI Helm chart.
+func (d *Deployer) renderHelmApp(req deployRequest, chart *ArgoHelmSource, owner Ownership) ([]renderedFile, error) {
+	appName := req.AppName
+	issuer, err := d.tlsIssuer(req)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to commit changes: %v", err)), nil
+		return nil, err
 	}
 
-	if err := repo.Push(&git.PushOptions{Auth: auth}); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to push changes: %v", err)), nil
+	argoData := ArgoApplicationData{
+		Ownership: owner,
+		Name:      appName,
+		Namespace: req.Namespace,
+		Helm: &ArgoHelmSource{
+			RepoURL:        chart.RepoURL,
+			Chart:          chart.Chart,
+			TargetRevision: chart.TargetRevision,
+			ReleaseName:    appName,
+			IngressName:    appName,
+			IngressHost:    d.appHost(appName),
+			TLSIssuer:      issuer,
+			IngressClass:   d.cfg.IngressClass,
+		},
 	}
-
-	if err := waitForArgoApplicationHealthy(ctx, appName, 3*time.Minute, 5*time.Second); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Git updated but ArgoCD did not become ready: %v", err)), nil
+	if d.authMethod(req) == authBasic {
+		return nil, fmt.Errorf("auth=%s is not supported for Helm charts; use auth=%s, which requires the server to be started with --auth-url", authBasic, authSSO)
 	}
-
-	if err := waitForIngressReachability(ctx, host, 2*time.Minute, 5*time.Second); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("ArgoCD synced %s but ingress did not become reachable: %v", appName, err)), nil
+	annotations, err := d.authAnnotations(req)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(annotations, req.IngressAnnotations)
+	if len(req.AllowedCIDRs) > 0 {
+		// The chart's pod labels are not known, so a Helm app is only
+		// restricted by the ingress controller.
+		if d.cfg.AllowlistAnnotation == "" {
+			return nil, fmt.Errorf("allowed_cidrs for Helm charts requires the server to be started with --allowlist-annotation")
+		}
+		annotations[d.cfg.AllowlistAnnotation] = strings.Join(req.AllowedCIDRs, ",")
 	}
-
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully deployed %s from Helm chart %s. ArgoCD is synced and %s is reachable.", appName, chartRef, host)), nil
+	argoData.HelmParameters = helmAnnotationParams(annotations)
+	app, err := d.renderArgoApplication("templates/application-helm.yaml", argoData)
+	if err != nil {
+		return nil, err
+	}
+	return []renderedFile{app}, nil
 }
 
 func parseOCIHelmChartRef(chartRef string) (*ArgoHelmSource, error) {
@@ -132,6 +142,11 @@ func parseOCIHelmChartRef(chartRef string) (*ArgoHelmSource, error) {
 		return nil, fmt.Errorf("expected format oci://registry/path/chart:version")
 	}
 
+	// An OCI chart reference has the same grammar as an image reference.
+	if _, err := parseImageReference(trimmed); err != nil {
+		return nil, err
+	}
+
 	return &ArgoHelmSource{
 		RepoURL:        repoURL,
 		Chart:          chart,
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Deployer implements the MCP tools. It holds the server configuration and
+// the clients used to reach the GitOps repository, the cluster and deployed
+// ingresses, so that tests can substitute a local bare repository and
+// client-go fakes.
+type Deployer struct {
+	cfg        Config
+	repo       GitRepository
+	kube       kubernetes.Interface
+	dyn        dynamic.Interface
+	httpClient *http.Client
+	// policy restricts what may be deployed; nil allows everything.
+	policy *Policy
+	// confirm holds the tokens destroy hands out between planning and
+	// deleting.
+	confirm *confirmations
+	// templates holds the manifest templates, the embedded ones unless
+	// overlaid by --templates-dir; extraTemplates are rendered for every image
+	// app in addition to the built-in ones.
+	templates      fs.FS
+	extraTemplates []string
+	// profiles are the template bundles deploy-image can render, by name.
+	profiles map[string]*Profile
+
+	// Tools that wait for ArgoCD and the ingress after pushing poll every
+	// pollInterval for up to argoTimeout and ingressTimeout respectively.
+	argoTimeout    time.Duration
+	ingressTimeout time.Duration
+	pollInterval   time.Duration
+}
+
+// NewDeployer returns a Deployer using the given clients.
+func NewDeployer(cfg Config, repo GitRepository, kube kubernetes.Interface, dyn dynamic.Interface) *Deployer {
+	return &Deployer{
+		cfg:       cfg,
+		repo:      repo,
+		kube:      kube,
+		dyn:       dyn,
+		confirm:   newConfirmations(5 * time.Minute),
+		templates: templatesFS,
+		profiles:  builtinProfiles(),
+		httpClient: &http.Client{
+			Timeout: 5 * time.Second,
+		},
+		argoTimeout:    3 * time.Minute,
+		ingressTimeout: 2 * time.Minute,
+		pollInterval:   5 * time.Second,
+	}
+}
+
+// newDeployerFromConfig connects a Deployer to the configured GitHub
+// repository and to the cluster described by the kubeconfig.
+func newDeployerFromConfig(cfg Config) (*Deployer, error) {
+	restConfig, err := clientcmd.BuildConfigFromFlags("", cfg.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("build kubeconfig: %w", err)
+	}
+
+	kube, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create Kubernetes client: %w", err)
+	}
+
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("create dynamic client: %w", err)
+	}
+
+	policy, err := loadPolicy(cfg.PolicyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, extraTemplates, err := loadTemplates(cfg.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := newRemoteGitRepository(cfg.GitHubURL, cfg.GitHubToken)
+	d := NewDeployer(cfg, repo, kube, dyn)
+	d.policy = policy
+	d.templates, d.extraTemplates = templates, extraTemplates
+	if d.profiles, err = loadProfiles(cfg.TemplatesDir, templates); err != nil {
+		return nil, err
+	}
+	d.extraTemplates = withoutProfileTemplates(d.extraTemplates, d.profiles)
+	return d, nil
+}
+
+// appHost is the ingress hostname of an application.
+func (d *Deployer) appHost(appName string) string {
+	return appName + "." + d.cfg.Domain
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mark3labs/mcp-go/mcp"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+var argoApplicationGVR = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "applications",
+}
+
+// newTestRepo creates a bare repository with a single initial commit and
+// returns its path.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+
+	seedDir := t.TempDir()
+	seed, err := git.PlainInit(seedDir, false)
+	if err != nil {
+		t.Fatalf("init seed repo: %v", err)
+	}
+	writeFile(t, filepath.Join(seedDir, "README.md"), "gitops\n")
+	w, err := seed.Worktree()
+	if err != nil {
+		t.Fatalf("seed worktree: %v", err)
+	}
+	if _, err := w.Add("README.md"); err != nil {
+		t.Fatalf("seed add: %v", err)
+	}
+	if _, err := w.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("seed commit: %v", err)
+	}
+
+	bareDir := filepath.Join(t.TempDir(), "gitops.git")
+	if _, err := git.PlainClone(bareDir, true, &git.CloneOptions{URL: seedDir}); err != nil {
+		t.Fatalf("clone bare repo: %v", err)
+	}
+	return bareDir
+}
+
+func newTestConfig() Config {
+	cfg := defaultConfig()
+	cfg.Domain = "example.com"
+	cfg.LocalAllowedSubnets = stringList{"192.168.0.0/16"}
+	return cfg
+}
+
+// newTestDeployer returns a Deployer backed by a fresh bare repository, a
+// fake clientset seeded with kubeObjects, a fake dynamic client seeded with
+// argoApps, and an HTTP client that never reaches the network.
+func newTestDeployer(t *testing.T, kubeObjects []runtime.Object, argoApps ...runtime.Object) (*Deployer, string) {
+	t.Helper()
+
+	repoDir := newTestRepo(t)
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{argoApplicationGVR: "ApplicationList", certificateGVR: "CertificateList"},
+		argoApps...,
+	)
+	d := NewDeployer(newTestConfig(), newRemoteGitRepository(repoDir, ""), kubefake.NewSimpleClientset(kubeObjects...), dyn)
+	d.httpClient = &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, os.ErrDeadlineExceeded
+	})}
+	return d, repoDir
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// readRepoFile returns the content of path at the HEAD of the bare
+// repository, or "" if it does not exist.
+func readRepoFile(t *testing.T, d *Deployer, path string) string {
+	t.Helper()
+	tree, err := d.repo.HeadTree(context.Background())
+	if err != nil {
+		t.Fatalf("read HEAD tree: %v", err)
+	}
+	f, err := tree.File(path)
+	if err != nil {
+		return ""
+	}
+	content, err := f.Contents()
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return content
+}
+
+var confirmTokenPattern = regexp.MustCompile(`confirm_token "([0-9a-f]+)"`)
+
+// confirmToken extracts the confirmation token from a destroy plan.
+func confirmToken(t *testing.T, plan string) string {
+	t.Helper()
+	m := confirmTokenPattern.FindStringSubmatch(plan)
+	if m == nil {
+		t.Fatalf("no confirm_token in destroy plan:\n%s", plan)
+	}
+	return m[1]
+}
+
+func resultText(res *mcp.CallToolResult) string {
+	var parts []string
+	for _, c := range res.Content {
+		if tc, ok := c.(mcp.TextContent); ok {
+			parts = append(parts, tc.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func TestDeployAndDestroyImage(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDeployer(t, nil)
+
+	res, err := d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposureLocal, Namespace: d.cfg.LocalNamespace}, "nginx:1.27")
+	if err != nil || res.IsError {
+		t.Fatalf("deploy failed: %v %s", err, resultText(res))
+	}
+
+	deployment := readRepoFile(t, d, "manifests/demo/deployment.yaml")
+	if !strings.Contains(deployment, "image: nginx:1.27") || !strings.Contains(deployment, "namespace: applications-local") {
+		t.Fatalf("unexpected deployment manifest:\n%s", deployment)
+	}
+	if ingress := readRepoFile(t, d, "manifests/demo/ingress.yaml"); !strings.Contains(ingress, "host: demo.example.com") {
+		t.Fatalf("unexpected ingress manifest:\n%s", ingress)
+	}
+	if app := readRepoFile(t, d, "argocd-apps/demo.yaml"); !strings.Contains(app, "path: manifests/demo") {
+		t.Fatalf("unexpected ArgoCD application:\n%s", app)
+	}
+	if np := readRepoFile(t, d, "manifests/local-namespace-network-policy/networkpolicy.yaml"); !strings.Contains(np, "cidr: 192.168.0.0/16") {
+		t.Fatalf("unexpected network policy:\n%s", np)
+	}
+
+	res, _ = d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposureLocal, Namespace: d.cfg.LocalNamespace, Mode: modeUpgrade}, "nginx:1.27")
+	if got := resultText(res); got != "No changes to deploy" {
+		t.Fatalf("redeploy result = %q", got)
+	}
+
+	res, err = d.destroy(ctx, "demo", "", false)
+	if err != nil || res.IsError {
+		t.Fatalf("destroy plan failed: %v %s", err, resultText(res))
+	}
+	if !strings.Contains(resultText(res), "- manifests/demo/deployment.yaml") {
+		t.Fatalf("destroy plan does not list the deployment:\n%s", resultText(res))
+	}
+	if readRepoFile(t, d, "argocd-apps/demo.yaml") == "" {
+		t.Fatal("destroy without confirmation removed the app")
+	}
+	token := confirmToken(t, resultText(res))
+	if res, _ := d.destroy(ctx, "other", token, false); !res.IsError || !strings.Contains(resultText(res), "different operation") {
+		t.Fatalf("token for demo accepted for other: %s", resultText(res))
+	}
+	res, err = d.destroy(ctx, "demo", token, false)
+	if err != nil || res.IsError {
+		t.Fatalf("destroy failed: %v %s", err, resultText(res))
+	}
+	for _, path := range []string{"manifests/demo/deployment.yaml", "argocd-apps/demo.yaml"} {
+		if readRepoFile(t, d, path) != "" {
+			t.Fatalf("%s still present after destroy", path)
+		}
+	}
+
+	if res, _ := d.destroy(ctx, "demo", token, false); !res.IsError || !strings.Contains(resultText(res), "already used") {
+		t.Fatalf("token reused: %s", resultText(res))
+	}
+	res, _ = d.destroy(ctx, "demo", "", false)
+	if got := resultText(res); !strings.Contains(got, "does not exist") {
+		t.Fatalf("second destroy result = %q", got)
+	}
+}
+
+func TestDryRunReturnsDiffWithoutPushing(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDeployer(t, nil)
+
+	res, err := d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace, DryRun: true}, "nginx:1.27")
+	if err != nil || res.IsError {
+		t.Fatalf("dry-run deploy failed: %v %s", err, resultText(res))
+	}
+	got := resultText(res)
+	for _, want := range []string{"+++ b/manifests/demo/deployment.yaml", "+        image: nginx:1.27", "+++ b/argocd-apps/demo.yaml"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("dry-run diff does not contain %q:\n%s", want, got)
+		}
+	}
+	if readRepoFile(t, d, "argocd-apps/demo.yaml") != "" {
+		t.Fatal("dry run pushed changes")
+	}
+
+	if res, _ := d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "nginx:1.27"); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+	res, _ = d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace, Mode: modeUpgrade, DryRun: true}, "nginx:1.28")
+	if got := resultText(res); !strings.Contains(got, "-        image: nginx:1.27\n+        image: nginx:1.28") {
+		t.Fatalf("dry-run diff does not show the image change:\n%s", got)
+	}
+
+	res, _ = d.destroy(ctx, "demo", "", true)
+	if got := resultText(res); !strings.Contains(got, "--- a/manifests/demo/service.yaml\n+++ /dev/null") {
+		t.Fatalf("dry-run destroy diff does not remove the service:\n%s", got)
+	}
+	if readRepoFile(t, d, "argocd-apps/demo.yaml") == "" {
+		t.Fatal("dry-run destroy removed the app")
+	}
+
+	res, _ = d.destroy(ctx, "absent", "", true)
+	if got := resultText(res); !strings.Contains(got, "would not change Git") {
+		t.Fatalf("dry-run destroy of a missing app = %q", got)
+	}
+}
+
+func TestUpdateRestartsDeployment(t *testing.T) {
+	ctx := context.Background()
+	existing := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "applications-local"}}
+	d, _ := newTestDeployer(t, []runtime.Object{existing})
+
+	res, err := d.update(ctx, "demo")
+	if err != nil || res.IsError {
+		t.Fatalf("update failed: %v %s", err, resultText(res))
+	}
+
+	got, err := d.kube.AppsV1().Deployments("applications-local").Get(ctx, "demo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if got.Spec.Template.Annotations["kubectl.kubernetes.io/restartedAt"] == "" {
+		t.Fatal("restartedAt annotation not set")
+	}
+
+	res, _ = d.update(ctx, "missing")
+	if !res.IsError {
+		t.Fatalf("expected error for missing deployment, got %s", resultText(res))
+	}
+}
+
+func TestStatusReportsGitAndArgo(t *testing.T) {
+	ctx := context.Background()
+	app := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]interface{}{"name": "demo", "namespace": "argocd"},
+		"status": map[string]interface{}{
+			"health": map[string]interface{}{"status": "Healthy"},
+			"sync":   map[string]interface{}{"status": "Synced"},
+		},
+	}}
+	d, _ := newTestDeployer(t, nil, app)
+
+	if res, _ := d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "nginx:1.27"); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+
+	res, err := d.status(ctx, "demo")
+	if err != nil {
+		t.Fatalf("status returned error: %v", err)
+	}
+	out := resultText(res)
+	for _, want := range []string{
+		"✅ Manifests present in Git",
+		"Health: Healthy, Sync: Synced",
+		"❌ Ingress unreachable: demo.example.com",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("status output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestConfirmationTokensExpire(t *testing.T) {
+	c := newConfirmations(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	token, err := c.issue("destroy demo")
+	if err != nil {
+		t.Fatalf("issue returned error: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := c.redeem(token, "destroy demo"); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expected expired token error, got %v", err)
+	}
+	if err := c.redeem(token, "destroy demo"); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected expired token to be discarded, got %v", err)
+	}
+}
+
+func TestOwnershipAndProtection(t *testing.T) {
+	// The live Deployment carries no ownership annotations, as with Helm
+	// charts; update authorizes against Git.
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "applications"}}
+	d, _ := newTestDeployer(t, []runtime.Object{deployment})
+	alice := withCaller(context.Background(), caller{Name: "alice"})
+	bob := withCaller(context.Background(), caller{Name: "bob"})
+	admin := withCaller(context.Background(), caller{Name: "root", Admin: true})
+	req := deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}
+
+	if res, _ := d.deploy(alice, req, "nginx:1.27"); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+	if app := readRepoFile(t, d, "argocd-apps/demo.yaml"); !strings.Contains(app, `mcp-app-deployer/owner: "alice"`) {
+		t.Fatalf("owner not recorded on ArgoCD application:\n%s", app)
+	}
+
+	for name, res := range map[string]*mcp.CallToolResult{
+		"redeploy": must(t)(d.deploy(bob, req, "nginx:1.28")),
+		"destroy":  must(t)(d.destroy(bob, "demo", "", false)),
+		"update":   must(t)(d.update(bob, "demo")),
+	} {
+		if !res.IsError || !strings.Contains(resultText(res), "owned by alice") {
+			t.Fatalf("%s by bob = %s, want ownership error", name, resultText(res))
+		}
+	}
+
+	protect := true
+	req.Mode = modeUpgrade
+	req.Protected = &protect
+	if res, _ := d.deploy(alice, req, "nginx:1.28"); res.IsError {
+		t.Fatalf("owner redeploy failed: %s", resultText(res))
+	}
+	if dep := readRepoFile(t, d, "manifests/demo/deployment.yaml"); !strings.Contains(dep, `mcp-app-deployer/protected: "true"`) {
+		t.Fatalf("protection not recorded on deployment:\n%s", dep)
+	}
+	if res, _ := d.destroy(alice, "demo", "", false); !res.IsError || !strings.Contains(resultText(res), "is protected") {
+		t.Fatalf("destroy of protected app by owner = %s", resultText(res))
+	}
+	if res, _ := d.update(alice, "demo"); !res.IsError || !strings.Contains(resultText(res), "is protected") {
+		t.Fatalf("update of protected app by owner = %s", resultText(res))
+	}
+
+	req.Protected = nil
+	if res, _ := d.deploy(admin, req, "nginx:1.29"); res.IsError {
+		t.Fatalf("admin redeploy failed: %s", resultText(res))
+	}
+	if app := readRepoFile(t, d, "argocd-apps/demo.yaml"); !strings.Contains(app, `owner: "alice"`) || !strings.Contains(app, `protected: "true"`) {
+		t.Fatalf("admin redeploy changed ownership:\n%s", app)
+	}
+	if res, _ := d.update(admin, "demo"); res.IsError {
+		t.Fatalf("admin update failed: %s", resultText(res))
+	}
+}
+
+func TestDestroyTokenBoundToCaller(t *testing.T) {
+	d, _ := newTestDeployer(t, nil)
+	alice := withCaller(context.Background(), caller{Name: "alice"})
+	bob := withCaller(context.Background(), caller{Name: "bob"})
+	admin := withCaller(context.Background(), caller{Name: "root", Admin: true})
+	if res := must(t)(d.deploy(alice, deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "nginx:1.27")); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+	token := confirmToken(t, resultText(must(t)(d.destroy(alice, "demo", "", false))))
+
+	// Neither a caller refused by ownership nor another caller allowed to
+	// destroy the app can use alice's token, and neither attempt burns it.
+	if res := must(t)(d.destroy(bob, "demo", token, false)); !res.IsError || !strings.Contains(resultText(res), "owned by alice") {
+		t.Fatalf("destroy by bob with alice's token = %s", resultText(res))
+	}
+	if res := must(t)(d.destroy(admin, "demo", token, false)); !res.IsError || !strings.Contains(resultText(res), "different operation") {
+		t.Fatalf("destroy by admin with alice's token = %s", resultText(res))
+	}
+	if res := must(t)(d.destroy(alice, "demo", token, false)); res.IsError {
+		t.Fatalf("destroy by alice failed: %s", resultText(res))
+	}
+	if readRepoFile(t, d, "argocd-apps/demo.yaml") != "" {
+		t.Fatal("app still present after destroy")
+	}
+}
+
+// must fails the test if a tool implementation returns an error, and
+// otherwise returns its result: must(t)(d.deploy(ctx, req, image)).
+func must(t *testing.T) func(*mcp.CallToolResult, error) *mcp.CallToolResult {
+	return func(res *mcp.CallToolResult, err error) *mcp.CallToolResult {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("tool returned error: %v", err)
+		}
+		return res
+	}
+}
+
+func TestDeployModes(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDeployer(t, nil)
+	public := deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}
+	local := deployRequest{AppName: "demo", Exposure: exposureLocal, Namespace: d.cfg.LocalNamespace}
+	const chart = "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0"
+
+	upgrade := public
+	upgrade.Mode = modeUpgrade
+	if res, _ := d.deploy(ctx, upgrade, "nginx:1.27"); !res.IsError || !strings.Contains(resultText(res), "does not exist") {
+		t.Fatalf("upgrade of missing app = %s", resultText(res))
+	}
+	if res, _ := d.deploy(ctx, public, "nginx:1.27"); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+
+	if res, _ := d.deploy(ctx, public, "nginx:1.28"); !res.IsError || !strings.Contains(resultText(res), "already exists (image nginx:1.27 in namespace applications, owned by stdio)") {
+		t.Fatalf("create over existing app = %s", resultText(res))
+	}
+	local.Mode = modeUpgrade
+	if res, _ := d.deploy(ctx, local, "nginx:1.28"); !res.IsError || !strings.Contains(resultText(res), "would move it to applications-local") {
+		t.Fatalf("upgrade to another namespace = %s", resultText(res))
+	}
+	if res, _ := d.deployHelmChart(ctx, upgrade, chart); !res.IsError || !strings.Contains(resultText(res), "would change its source type") {
+		t.Fatalf("upgrade to a Helm chart = %s", resultText(res))
+	}
+
+	local.Mode = modeReplace
+	if res, _ := d.deploy(ctx, local, "nginx:1.28"); res.IsError {
+		t.Fatalf("replace failed: %s", resultText(res))
+	}
+	if app := readRepoFile(t, d, "argocd-apps/demo.yaml"); !strings.Contains(app, "namespace: applications-local") {
+		t.Fatalf("replace did not move the app:\n%s", app)
+	}
+
+	local.DryRun = true
+	res, _ := d.deployHelmChart(ctx, local, chart)
+	got := resultText(res)
+	for _, want := range []string{"--- a/manifests/demo/deployment.yaml\n+++ /dev/null", "+    chart: nginx"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("replace with a Helm chart diff does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+// editRepoFile commits a manual change to path, as a human would.
+func editRepoFile(t *testing.T, d *Deployer, path string, edit func(string) string) {
+	t.Helper()
+	ctx := context.Background()
+	ws, err := d.checkout(ctx)
+	if err != nil {
+		t.Fatalf("checkout: %v", err)
+	}
+	defer ws.close()
+	content, err := ws.readFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if err := ws.writeFile(path, []byte(edit(string(content)))); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := d.commitAndPush(ctx, ws, "Manual edit of "+path); err != nil {
+		t.Fatalf("commit %s: %v", path, err)
+	}
+}
+
+func TestRedeployPreservesManualEdits(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDeployer(t, nil)
+	req := deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}
+	if res, _ := d.deploy(ctx, req, "nginx:1.27"); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+	if readRepoFile(t, d, ".mcp-app-deployer/generated/demo/manifests/demo/deployment.yaml") == "" {
+		t.Fatal("generated copy of the deployment not recorded")
+	}
+
+	editRepoFile(t, d, "manifests/demo/deployment.yaml", func(s string) string {
+		s = strings.Replace(s, "replicas: 1", "replicas: 3", 1)
+		s = strings.Replace(s, "        ports:\n", "        env:\n        - name: LOG_LEVEL\n          value: debug\n        ports:\n", 1)
+		return s + "      - name: sidecar\n        image: busybox:1.36\n"
+	})
+	editRepoFile(t, d, "argocd-apps/demo.yaml", func(s string) string {
+		return s + "    syncOptions:\n    - CreateNamespace=true\n"
+	})
+
+	req.Mode = modeUpgrade
+	if res, _ := d.deploy(ctx, req, "nginx:1.28"); res.IsError {
+		t.Fatalf("redeploy failed: %s", resultText(res))
+	}
+
+	deployment := readRepoFile(t, d, "manifests/demo/deployment.yaml")
+	for _, want := range []string{"image: nginx:1.28", "replicas: 3", "name: LOG_LEVEL", "image: busybox:1.36"} {
+		if !strings.Contains(deployment, want) {
+			t.Fatalf("merged deployment does not contain %q:\n%s", want, deployment)
+		}
+	}
+	if strings.Contains(deployment, "nginx:1.27") {
+		t.Fatalf("merged deployment still has the old image:\n%s", deployment)
+	}
+	if app := readRepoFile(t, d, "argocd-apps/demo.yaml"); !strings.Contains(app, "CreateNamespace=true") {
+		t.Fatalf("manual edit of the ArgoCD application lost:\n%s", app)
+	}
+
+	// A broken manual edit is reported rather than overwritten.
+	editRepoFile(t, d, "manifests/demo/service.yaml", func(s string) string { return s + "---\nkind: ConfigMap\n" })
+	res, _ := d.deploy(ctx, req, "nginx:1.29")
+	if !res.IsError || !strings.Contains(resultText(res), "mode=replace") {
+		t.Fatalf("expected merge error suggesting mode=replace, got %s", resultText(res))
+	}
+}
+
+func TestMergeManifestWithoutGeneratedCopy(t *testing.T) {
+	m, err := renderManifest(templatesFS, "templates/deployment.yaml", ImageManifestData{Name: "demo", Image: "nginx:1.28", Namespace: "applications"})
+	if err != nil {
+		t.Fatalf("renderManifest returned error: %v", err)
+	}
+	current := strings.Replace(strings.Replace(string(m.Content), "nginx:1.28", "nginx:1.27", 1),
+		"      labels:\n", "      annotations:\n        team: payments\n      labels:\n", 1)
+
+	merged, err := mergeManifest(nil, m.Content, []byte(current), renderedFile{manifest: m})
+	if err != nil {
+		t.Fatalf("mergeManifest returned error: %v", err)
+	}
+	if got := string(merged); !strings.Contains(got, "image: nginx:1.28") || !strings.Contains(got, "team: payments") {
+		t.Fatalf("merge without a generated copy should apply rendered fields and keep extras:\n%s", got)
+	}
+}
+
+func TestWorkersAndExposureNone(t *testing.T) {
+	h := newHarness(t)
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "consumer", "image": "busybox:1.36", "profile": workerProfile}, false)
+	deployment := readRepoFile(t, h.d, "manifests/consumer/deployment.yaml")
+	if deployment == "" || strings.Contains(deployment, "livenessProbe") {
+		t.Fatalf("unexpected worker deployment:\n%s", deployment)
+	}
+	for _, path := range []string{"manifests/consumer/service.yaml", "manifests/consumer/ingress.yaml"} {
+		if readRepoFile(t, h.d, path) != "" {
+			t.Fatalf("worker rendered %s", path)
+		}
+	}
+	if out := h.call("status", map[string]interface{}{"app_name": "consumer"}, false); !strings.Contains(out, "➖ No Ingress") || strings.Contains(out, "Ingress unreachable") {
+		t.Fatalf("status probed the worker's ingress:\n%s", out)
+	}
+
+	// Upgrades without profile keep the worker profile.
+	h.call("deploy-image", map[string]interface{}{"app_name": "consumer", "image": "busybox:1.37", "mode": modeUpgrade}, false)
+	deployment = readRepoFile(t, h.d, "manifests/consumer/deployment.yaml")
+	if !strings.Contains(deployment, "busybox:1.37") || strings.Contains(deployment, "livenessProbe") || readRepoFile(t, h.d, "manifests/consumer/service.yaml") != "" {
+		t.Fatalf("upgrade without profile changed the worker:\n%s", deployment)
+	}
+
+	// Redeploying a web app with exposure=none drops its Ingress but keeps
+	// the cluster-internal Service.
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.27"}, false)
+	if readRepoFile(t, h.d, "manifests/api/ingress.yaml") == "" {
+		t.Fatal("public app has no ingress")
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.27", "exposure": exposureNone, "mode": modeUpgrade}, false)
+	for path, want := range map[string]bool{
+		"manifests/api/ingress.yaml":                                 false,
+		".mcp-app-deployer/generated/api/manifests/api/ingress.yaml": false,
+		"manifests/api/service.yaml":                                 true,
+		"manifests/api/deployment.yaml":                              true,
+	} {
+		if got := readRepoFile(t, h.d, path) != ""; got != want {
+			t.Errorf("%s present = %v, want %v", path, got, want)
+		}
+	}
+	if out := h.call("status", map[string]interface{}{"app_name": "api"}, false); !strings.Contains(out, "➖ No Ingress") {
+		t.Fatalf("status probed a removed ingress:\n%s", out)
+	}
+
+	// Upgrades without exposure keep the app without an Ingress.
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.28", "mode": modeUpgrade}, false)
+	if readRepoFile(t, h.d, "manifests/api/ingress.yaml") != "" {
+		t.Fatal("upgrade without exposure gave an exposure=none app an ingress")
+	}
+	out := h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.28", "mode": modeUpgrade, "hosts": []interface{}{"api.example.org"}}, true)
+	if !strings.Contains(out, "has no Ingress") {
+		t.Fatalf("unexpected result for hosts on an app without ingress: %s", out)
+	}
+
+	out = h.call("deploy-helmchart", map[string]interface{}{"app_name": "chart", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0", "exposure": exposureNone}, true)
+	if !strings.Contains(out, "not supported for Helm charts") {
+		t.Fatalf("unexpected deploy-helmchart result: %s", out)
+	}
+}
@@ -2,103 +2,109 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"time"
+	"path"
+	"slices"
+	"strings"
 
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-func destroy(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
+// destroy removes an application in two phases. Without confirmToken it only
+// plans: it reports what would be removed and returns a confirmation token.
+// Called again with that token by the same caller it commits the removal.
+// The token is only redeemed once the caller is authorized, so a failed
+// attempt leaves it valid.
+func (d *Deployer) destroy(ctx context.Context, appName, confirmToken string, dryRun bool) (*mcp.CallToolResult, error) {
+	c := callerFrom(ctx)
+	action := fmt.Sprintf("destroy %s by %s", appName, c.Name)
+
 	// 1. Clone the repository
-	tempDir, err := os.MkdirTemp("", "mcp-destroyer-")
+	ws, err := d.checkout(ctx)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create temp dir: %v", err)), nil
-	}
-	defer os.RemoveAll(tempDir)
-
-	auth := &http.BasicAuth{
-		Username: "oauth2",
-		Password: githubToken,
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
 	}
+	defer ws.close()
 
-	repo, err := git.PlainClone(tempDir, false, &git.CloneOptions{
-		URL:  githubURL,
-		Auth: auth,
-	})
+	owner, exists, err := d.readOwnership(ws, appName)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to clone repo: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
 	}
-
-	w, err := repo.Worktree()
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get worktree: %v", err)), nil
+	if exists {
+		if err := owner.authorize(c, appName); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 	}
-
-	// 2. Remove files
-	manifestDir := filepath.Join(manifestPath, appName)
-	if _, err := w.Filesystem.Stat(manifestDir); err == nil {
-		if _, err := w.Remove(manifestDir); err != nil {
-			// Try recursive removal if directory
-			if err := os.RemoveAll(filepath.Join(tempDir, manifestDir)); err != nil {
-				return mcp.NewToolResultError(fmt.Sprintf("Failed to remove manifest dir: %v", err)), nil
-			}
-			// Add the removal to git index
-			if _, err := w.Add(manifestPath); err != nil {
-				// If adding the parent dir fails, we might need to be more specific or use `w.Remove` correctly on files.
-				// For simplicity, let's try `git rm -r` equivalent.
-				// Since go-git `Remove` is file-based, removing a directory can be tricky.
-				// The easiest way is to remove from filesystem and then `w.Add(".")`.
-			}
+	if confirmToken != "" && !dryRun {
+		if err := d.confirm.redeem(confirmToken, action); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
 		}
-	} else {
-		// Does not exist, ignore
 	}
 
-	// Clean up robustly: delete from FS, then Add(all)
-	if err := os.RemoveAll(filepath.Join(tempDir, manifestDir)); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to remove manifest dir from FS: %v", err)), nil
+	// 2. Remove files
+	if err := ws.removeAll(path.Join(d.cfg.ManifestPath, appName)); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to remove manifest dir: %v", err)), nil
 	}
 
-	argoAppFile := filepath.Join(argocdAppPath, appName+".yaml")
-	if err := os.Remove(filepath.Join(tempDir, argoAppFile)); err != nil && !os.IsNotExist(err) {
+	if err := ws.removeAll(d.argoAppFile(appName)); err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to remove argo app file: %v", err)), nil
 	}
 
-	// Add changes to index (including deletions)
-	if _, err := w.Add("."); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to stage changes: %v", err)), nil
+	if err := ws.removeAll(path.Join(generatedDir, appName)); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to remove generated copies: %v", err)), nil
+	}
+
+	// Without --local-allowed-subnets the local namespace keeps its policy.
+	if exists {
+		if err := d.reconcileLocalNetworkPolicy(ws); err != nil && !errors.Is(err, errLocalSubnetsUnset) {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to reconcile local network policy: %v", err)), nil
+		}
+	}
+
+	if dryRun {
+		return dryRunResult(ws, "destroying "+appName)
+	}
+	if confirmToken == "" {
+		return d.destroyPlan(ws, appName, action)
 	}
 
 	// 3. Commit and Push
-	status, err := w.Status()
+	commitMsg := fmt.Sprintf("Destroy application %s", appName)
+	if err := d.commitAndPush(ctx, ws, commitMsg); err == errNoChanges {
+		return mcp.NewToolResultText(fmt.Sprintf("App %s does not exist or already destroyed", appName)), nil
+	} else if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully destroyed %s (manifests removed).", appName)), nil
+}
+
+// destroyPlan lists the files staged for removal in ws and issues the token
+// that confirms the removal.
+func (d *Deployer) destroyPlan(ws *workspace, appName, action string) (*mcp.CallToolResult, error) {
+	status, err := ws.w.Status()
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to get git status: %v", err)), nil
 	}
-
 	if status.IsClean() {
 		return mcp.NewToolResultText(fmt.Sprintf("App %s does not exist or already destroyed", appName)), nil
 	}
 
-	commitMsg := fmt.Sprintf("Destroy application %s", appName)
-	_, err = w.Commit(commitMsg, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  "MCP App Deployer",
-			Email: "mcp-deployer@bot.local",
-			When:  time.Now(),
-		},
-	})
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to commit changes: %v", err)), nil
+	files := make([]string, 0, len(status))
+	for file := range status {
+		files = append(files, "- "+file)
 	}
+	slices.Sort(files)
 
-	if err := repo.Push(&git.PushOptions{Auth: auth}); err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to push changes: %v", err)), nil
+	token, err := d.confirm.issue(action)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to issue confirmation token: %v", err)), nil
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully destroyed %s (manifests removed).", appName)), nil
+	return mcp.NewToolResultText(fmt.Sprintf(
+		"Destroying %s will remove these files from Git, and ArgoCD will prune everything they created:\n%s\n\n"+
+			"Nothing has been deleted yet. To proceed, call destroy again with app_name %q and confirm_token %q within %s.",
+		appName, strings.Join(files, "\n"), appName, token, d.confirm.ttl,
+	)), nil
 }
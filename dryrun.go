@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// dryRunResult reports the changes staged in ws as a unified diff instead of
+// committing them. action describes what a real run would do, e.g.
+// "deploy demo".
+func dryRunResult(ws *workspace, action string) (*mcp.CallToolResult, error) {
+	diff, err := ws.diff()
+	if err == errNoChanges {
+		return mcp.NewToolResultText(fmt.Sprintf("Dry run: %s would not change Git.", action)), nil
+	} else if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Dry run: %s would commit the following changes (nothing was pushed):\n\n```diff\n%s```", action, diff)), nil
+}
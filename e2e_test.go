@@ -166,7 +166,7 @@ func TestE2E(t *testing.T) {
 
 	// 6. Test Destroy
 	t.Log("Testing Destroy...")
-	destroyRes, err := cli.CallTool(ctx, mcp.CallToolRequest{
+	planRes, err := cli.CallTool(ctx, mcp.CallToolRequest{
 		Params: mcp.CallToolParams{
 			Name: "destroy",
 			Arguments: map[string]interface{}{
@@ -174,6 +174,19 @@ func TestE2E(t *testing.T) {
 			},
 		},
 	})
+	if err != nil {
+		t.Fatalf("Destroy plan failed: %v", err)
+	}
+	printResult(t, "Destroy plan", planRes)
+	destroyRes, err := cli.CallTool(ctx, mcp.CallToolRequest{
+		Params: mcp.CallToolParams{
+			Name: "destroy",
+			Arguments: map[string]interface{}{
+				"app_name":      appName,
+				"confirm_token": confirmToken(t, resultText(planRes)),
+			},
+		},
+	})
 	if err != nil {
 		t.Fatalf("Destroy failed: %v", err)
 	}
@@ -183,6 +196,61 @@ func TestE2E(t *testing.T) {
 	}
 }
 
+// TestE2ELocal runs the same flow as TestE2E plus Helm deploys and updates,
+// hermetically: see newHarness.
+func TestE2ELocal(t *testing.T) {
+	h := newHarness(t)
+
+	appName := "e2e-test-app"
+	image := "sauliusalisauskas/testappgo:latest"
+
+	t.Log("Testing Deploy Image...")
+	h.call("deploy-image", map[string]interface{}{"app_name": appName, "image": image}, false)
+
+	t.Log("Testing Status...")
+	out := h.call("status", map[string]interface{}{"app_name": appName}, false)
+	for _, want := range []string{"✅ Manifests present in Git", "Health: Progressing, Sync: OutOfSync"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("first status missing %q:\n%s", want, out)
+		}
+	}
+	out = h.call("status", map[string]interface{}{"app_name": appName}, false)
+	for _, want := range []string{"Health: Healthy, Sync: Synced", "✅ Ingress reachable: http://e2e-test-app.example.com"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("second status missing %q:\n%s", want, out)
+		}
+	}
+
+	t.Log("Testing Update...")
+	out = h.call("update", map[string]interface{}{"app_name": appName}, false)
+	if !strings.Contains(out, "namespace applications") {
+		t.Fatalf("unexpected update result: %s", out)
+	}
+
+	t.Log("Testing Deploy Helm Chart...")
+	out = h.call("deploy-helmchart", map[string]interface{}{
+		"app_name": "e2e-helm-app",
+		"chart":    "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0",
+		"exposure": "local",
+	}, false)
+	if !strings.Contains(out, "ArgoCD is synced and e2e-helm-app.example.com is reachable") {
+		t.Fatalf("unexpected deploy-helmchart result: %s", out)
+	}
+	h.call("update", map[string]interface{}{"app_name": "e2e-helm-app"}, true)
+
+	t.Log("Testing Destroy...")
+	for _, name := range []string{appName, "e2e-helm-app"} {
+		plan := h.call("destroy", map[string]interface{}{"app_name": name}, false)
+		h.call("destroy", map[string]interface{}{"app_name": name, "confirm_token": confirmToken(t, plan)}, false)
+		out = h.call("status", map[string]interface{}{"app_name": name}, false)
+		for _, want := range []string{"❌ Manifests NOT found in Git", "❌ ArgoCD Application not found", "❌ Ingress unreachable"} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("status after destroy missing %q:\n%s", want, out)
+			}
+		}
+	}
+}
+
 func printResult(t *testing.T, op string, res *mcp.CallToolResult) {
 	if res == nil {
 		t.Logf("%s result is nil", op)
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// egressNetworkPolicyFile is the manifest, rendered from
+// templates/app-egress-networkpolicy.yaml, restricting where an app's pods
+// may connect to.
+const egressNetworkPolicyFile = "egress-networkpolicy.yaml"
+
+// egressUnrestricted is the egress argument removing an app's egress
+// policy.
+const egressUnrestricted = "unrestricted"
+
+// namespaceNameLabel is set by Kubernetes on every namespace to its name.
+const namespaceNameLabel = "kubernetes.io/metadata.name"
+
+// EgressPolicy is where an app's pods may connect to besides cluster DNS,
+// which is always allowed: the CIDRs and namespaces listed, on the ports
+// listed. With no ports every port is allowed, and with no CIDRs and
+// namespaces every destination on the ports listed. Unrestricted removes the
+// policy.
+type EgressPolicy struct {
+	Unrestricted bool
+	CIDRs        []string
+	Namespaces   []string
+	Ports        []EgressPort
+}
+
+// EgressPort is a destination port an app may connect to.
+type EgressPort struct {
+	Port     int
+	Protocol string
+}
+
+// restricted reports whether p renders an egress NetworkPolicy.
+func (p *EgressPolicy) restricted() bool {
+	return p != nil && !p.Unrestricted
+}
+
+// EgressManifestData is rendered by templates/app-egress-networkpolicy.yaml.
+type EgressManifestData struct {
+	Ownership
+	Name      string
+	Namespace string
+	Egress    *EgressPolicy
+}
+
+// egressArg returns the optional egress argument: "unrestricted", or an
+// object with any of cidrs, namespaces and ports, returned in canonical
+// form. It returns nil if the argument was not given.
+func egressArg(args map[string]interface{}) (*EgressPolicy, error) {
+	raw, ok := args["egress"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	if s, ok := raw.(string); ok {
+		if s != egressUnrestricted {
+			return nil, fmt.Errorf("egress must be %q or an object with cidrs, namespaces and ports", egressUnrestricted)
+		}
+		return &EgressPolicy{Unrestricted: true}, nil
+	}
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("egress must be %q or an object with cidrs, namespaces and ports", egressUnrestricted)
+	}
+	for k := range obj {
+		if k != "cidrs" && k != "namespaces" && k != "ports" {
+			return nil, fmt.Errorf("egress has unknown field %q; expected cidrs, namespaces and ports", k)
+		}
+	}
+
+	policy := &EgressPolicy{}
+	cidrs, err := stringListArg(obj, "cidrs")
+	if err != nil {
+		return nil, fmt.Errorf("egress.%w", err)
+	}
+	if len(cidrs) > 0 {
+		if policy.CIDRs, err = canonicalCIDRs("egress.cidrs", cidrs); err != nil {
+			return nil, err
+		}
+	}
+
+	namespaces, err := stringListArg(obj, "namespaces")
+	if err != nil {
+		return nil, fmt.Errorf("egress.%w", err)
+	}
+	for _, ns := range namespaces {
+		if msgs := validation.IsDNS1123Label(ns); len(msgs) > 0 {
+			return nil, fmt.Errorf("egress.namespaces: %q is invalid: %s", ns, strings.Join(msgs, "; "))
+		}
+		if !slices.Contains(policy.Namespaces, ns) {
+			policy.Namespaces = append(policy.Namespaces, ns)
+		}
+	}
+	slices.Sort(policy.Namespaces)
+
+	if rawPorts, ok := obj["ports"]; ok && rawPorts != nil {
+		items, ok := rawPorts.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("egress.ports must be an array of ports such as 443 or \"53/UDP\"")
+		}
+		for _, item := range items {
+			port, err := parseEgressPort(item)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Contains(policy.Ports, port) {
+				policy.Ports = append(policy.Ports, port)
+			}
+		}
+		slices.SortFunc(policy.Ports, func(a, b EgressPort) int {
+			return cmp.Or(cmp.Compare(a.Port, b.Port), strings.Compare(a.Protocol, b.Protocol))
+		})
+	}
+	return policy, nil
+}
+
+// parseEgressPort parses a port number, or a string of a port number with
+// an optional protocol such as "53/UDP". The protocol defaults to TCP.
+func parseEgressPort(item interface{}) (EgressPort, error) {
+	var spec string
+	switch v := item.(type) {
+	case float64:
+		spec = strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		spec = v
+	default:
+		return EgressPort{}, fmt.Errorf("egress.ports: %v must be a port number or a string such as \"53/UDP\"", item)
+	}
+	number, protocol, found := strings.Cut(spec, "/")
+	port := EgressPort{Protocol: string(corev1.ProtocolTCP)}
+	if found {
+		port.Protocol = strings.ToUpper(protocol)
+	}
+	switch corev1.Protocol(port.Protocol) {
+	case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+	default:
+		return EgressPort{}, fmt.Errorf("egress.ports: %q has an invalid protocol; use TCP, UDP or SCTP", spec)
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || len(validation.IsValidPortNum(n)) > 0 {
+		return EgressPort{}, fmt.Errorf("egress.ports: %q is not a valid port number", spec)
+	}
+	port.Port = n
+	return port, nil
+}
+
+// renderEgressPolicy renders the egress NetworkPolicy of the app in req, if
+// its egress is restricted.
+func (d *Deployer) renderEgressPolicy(req deployRequest, owner Ownership) ([]renderedFile, error) {
+	if !req.Egress.restricted() {
+		return nil, nil
+	}
+	data := EgressManifestData{Ownership: owner, Name: req.AppName, Namespace: req.Namespace, Egress: req.Egress}
+	m, err := renderManifest(d.templates, "templates/app-egress-networkpolicy.yaml", data)
+	if err != nil {
+		return nil, fmt.Errorf("template app-egress-networkpolicy.yaml: %w", err)
+	}
+	return []renderedFile{{path: path.Join(d.cfg.ManifestPath, req.AppName, egressNetworkPolicyFile), manifest: m}}, nil
+}
+
+// egressFromNetworkPolicy reads the destinations of a rendered egress
+// NetworkPolicy back, leaving out the DNS rule every policy has.
+func egressFromNetworkPolicy(raw []byte) *EgressPolicy {
+	var np networkingv1.NetworkPolicy
+	if yaml.Unmarshal(raw, &np) != nil {
+		return nil
+	}
+	policy := &EgressPolicy{}
+	for _, rule := range np.Spec.Egress {
+		if isDNSEgressRule(rule) {
+			continue
+		}
+		for _, peer := range rule.To {
+			if peer.IPBlock != nil {
+				policy.CIDRs = append(policy.CIDRs, peer.IPBlock.CIDR)
+			}
+			if peer.NamespaceSelector != nil {
+				if ns := peer.NamespaceSelector.MatchLabels[namespaceNameLabel]; ns != "" {
+					policy.Namespaces = append(policy.Namespaces, ns)
+				}
+			}
+		}
+		for _, p := range rule.Ports {
+			port := EgressPort{Protocol: string(corev1.ProtocolTCP)}
+			if p.Protocol != nil {
+				port.Protocol = string(*p.Protocol)
+			}
+			if p.Port != nil {
+				port.Port = p.Port.IntValue()
+			}
+			policy.Ports = append(policy.Ports, port)
+		}
+	}
+	return policy
+}
+
+func isDNSEgressRule(rule networkingv1.NetworkPolicyEgressRule) bool {
+	for _, peer := range rule.To {
+		if peer.PodSelector != nil && peer.PodSelector.MatchLabels["k8s-app"] == "kube-dns" {
+			return true
+		}
+	}
+	return false
+}
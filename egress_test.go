@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEgressArg(t *testing.T) {
+	tests := []struct {
+		name    string
+		egress  interface{}
+		want    *EgressPolicy
+		wantErr string
+	}{
+		{name: "omitted"},
+		{name: "unrestricted", egress: "unrestricted", want: &EgressPolicy{Unrestricted: true}},
+		{name: "dns only", egress: map[string]interface{}{}, want: &EgressPolicy{}},
+		{
+			name: "canonical",
+			egress: map[string]interface{}{
+				"cidrs":      []interface{}{"10.1.2.3/8", "192.168.1.0/24", "10.0.0.0/8"},
+				"namespaces": []interface{}{"monitoring", "databases", "monitoring"},
+				"ports":      []interface{}{"5432", float64(443), "53/udp", "443/TCP"},
+			},
+			want: &EgressPolicy{
+				CIDRs:      []string{"10.0.0.0/8", "192.168.1.0/24"},
+				Namespaces: []string{"databases", "monitoring"},
+				Ports:      []EgressPort{{53, "UDP"}, {443, "TCP"}, {5432, "TCP"}},
+			},
+		},
+		{name: "other string", egress: "none", wantErr: `egress must be "unrestricted" or an object`},
+		{name: "unknown field", egress: map[string]interface{}{"hosts": []interface{}{"example.com"}}, wantErr: `unknown field "hosts"`},
+		{name: "bad cidr", egress: map[string]interface{}{"cidrs": []interface{}{"10.0.0.1"}}, wantErr: `egress.cidrs: "10.0.0.1" is not a valid CIDR`},
+		{name: "bad namespace", egress: map[string]interface{}{"namespaces": []interface{}{"Databases"}}, wantErr: `egress.namespaces: "Databases" is invalid`},
+		{name: "bad port", egress: map[string]interface{}{"ports": []interface{}{float64(70000)}}, wantErr: `"70000" is not a valid port number`},
+		{name: "bad protocol", egress: map[string]interface{}{"ports": []interface{}{"53/ICMP"}}, wantErr: `"53/ICMP" has an invalid protocol`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := map[string]interface{}{}
+			if test.egress != nil {
+				args["egress"] = test.egress
+			}
+			got, err := egressArg(args)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("egressArg() error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("egressArg() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("egressArg() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEgressPolicy(t *testing.T) {
+	h := newHarness(t)
+	const npFile = "manifests/api/" + egressNetworkPolicyFile
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.27"}, false)
+	if np := readRepoFile(t, h.d, npFile); np != "" {
+		t.Fatalf("egress policy rendered without egress:\n%s", np)
+	}
+
+	egress := map[string]interface{}{"namespaces": []interface{}{"databases"}, "ports": []interface{}{"5432"}}
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.27", "egress": egress, "mode": modeUpgrade}, false)
+	np := readRepoFile(t, h.d, npFile)
+	for _, want := range []string{"name: api-egress", "k8s-app: kube-dns", "kubernetes.io/metadata.name: databases", "port: 5432"} {
+		if !strings.Contains(np, want) {
+			t.Errorf("egress policy lacks %q:\n%s", want, np)
+		}
+	}
+	if got := egressFromNetworkPolicy([]byte(np)); !reflect.DeepEqual(got, &EgressPolicy{Namespaces: []string{"databases"}, Ports: []EgressPort{{5432, "TCP"}}}) {
+		t.Errorf("egressFromNetworkPolicy() = %+v", got)
+	}
+
+	// An upgrade keeps the restriction, and "unrestricted" removes it.
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.28", "mode": modeUpgrade}, false)
+	if got := readRepoFile(t, h.d, npFile); got != np {
+		t.Fatalf("upgrade changed the egress policy:\n%s", got)
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.28", "mode": modeUpgrade, "egress": egressUnrestricted}, false)
+	if got := readRepoFile(t, h.d, npFile); got != "" {
+		t.Fatalf("egress=unrestricted kept the policy:\n%s", got)
+	}
+
+	// Ports without destinations allow any destination on those ports.
+	h.call("deploy-cronjob", map[string]interface{}{"app_name": "backup", "image": "restic/restic:0.17", "schedule": "@daily", "egress": map[string]interface{}{"ports": []interface{}{float64(443)}}}, false)
+	if np := readRepoFile(t, h.d, "manifests/backup/"+egressNetworkPolicyFile); !strings.Contains(np, "    - ports:\n        - protocol: TCP\n          port: 443") {
+		t.Fatalf("cronjob egress policy:\n%s", np)
+	}
+
+	out := h.call("deploy-helmchart", map[string]interface{}{"app_name": "chart", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0", "egress": egressUnrestricted}, true)
+	if !strings.Contains(out, "egress is not supported for Helm charts") {
+		t.Fatalf("unexpected error: %s", out)
+	}
+}
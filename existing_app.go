@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Deploy modes decide what happens when app_name is already deployed.
+const (
+	// modeCreate refuses to touch an existing app.
+	modeCreate = "create"
+	// modeUpgrade changes the image or chart of an existing app, keeping its
+	// source type and namespace.
+	modeUpgrade = "upgrade"
+	// modeReplace removes everything the existing app has in Git and deploys
+	// the new one in the same commit, so that ArgoCD prunes what is left over
+	// from a different namespace or source type.
+	modeReplace = "replace"
+)
+
+// Source types of an app.
+const (
+	sourceImage   = "image"
+	sourceHelm    = "helm"
+	sourceCronJob = "cronjob"
+	sourceJob     = "job"
+)
+
+// workloadFiles are the manifests holding the container image of each
+// Git-sourced app type.
+var workloadFiles = map[string]string{
+	sourceImage:   "deployment.yaml",
+	sourceCronJob: "cronjob.yaml",
+	sourceJob:     "job.yaml",
+}
+
+// existingApp is what the GitOps repository holds for a deployed app.
+type existingApp struct {
+	Source    string
+	Image     string // for sourceImage, sourceCronJob and sourceJob
+	Chart     string // for sourceHelm, as an oci:// reference
+	Namespace string
+	Ownership
+	// Profile and Parameters, for sourceImage, are those the app was
+	// deployed with.
+	Profile    string
+	Parameters map[string]interface{}
+	// HasIngress is whether the app is served at <app>.<domain>: true for Helm
+	// charts, and for Git-sourced apps with an ingress.yaml.
+	HasIngress bool
+	// TLS is whether the Ingress requests a cert-manager certificate.
+	TLS bool
+	// Aliases, Path and IngressAnnotations are the Ingress options the app
+	// was deployed with. Helm apps only record annotations.
+	Aliases            []string
+	Path               string
+	IngressAnnotations map[string]string
+	// AllowedCIDRs are the app's own source allowlist, if it has one.
+	AllowedCIDRs []string
+	// Auth is the authentication method of an app deployed with
+	// exposure=authenticated, and BasicAuth its htpasswd entry for
+	// authBasic.
+	Auth      string
+	BasicAuth string
+	// Egress is the app's egress restriction, or nil if it has none.
+	Egress *EgressPolicy
+}
+
+func (a *existingApp) String() string {
+	what := "image " + a.Image
+	switch {
+	case a.Source == sourceHelm:
+		what = "Helm chart " + a.Chart
+	case a.Source == sourceCronJob:
+		what = "CronJob with image " + a.Image
+	case a.Source == sourceJob:
+		what = "Job with image " + a.Image
+	case a.Profile != defaultProfile:
+		what += " (profile " + a.Profile + ")"
+	}
+	owner := ""
+	if a.Owner != "" {
+		owner = ", owned by " + a.Owner
+	}
+	return fmt.Sprintf("%s in namespace %s%s", what, a.Namespace, owner)
+}
+
+// readExistingApp describes appName as found in files, or returns nil if it
+// is not deployed.
+func (d *Deployer) readExistingApp(files repoFiles, appName string) (*existingApp, error) {
+	appFile := d.argoAppFile(appName)
+	raw, err := files.readFile(appFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	app := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(raw, &app.Object); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", appFile, err)
+	}
+
+	existing := &existingApp{Source: sourceImage, Ownership: ownershipFromAnnotations(app.GetAnnotations())}
+	existing.Namespace, _, _ = unstructured.NestedString(app.Object, "spec", "destination", "namespace")
+	if chart, ok, _ := unstructured.NestedString(app.Object, "spec", "source", "chart"); ok {
+		repoURL, _, _ := unstructured.NestedString(app.Object, "spec", "source", "repoURL")
+		version, _, _ := unstructured.NestedString(app.Object, "spec", "source", "targetRevision")
+		existing.Source = sourceHelm
+		existing.Chart = fmt.Sprintf("oci://%s/%s:%s", repoURL, chart, version)
+		existing.HasIngress = true
+		d.readHelmIngressOptions(existing, app)
+		return existing, nil
+	}
+
+	existing.Profile = defaultProfile
+	if profile := app.GetAnnotations()[profileAnnotation]; profile != "" {
+		existing.Profile = profile
+	}
+	if params := app.GetAnnotations()[parametersAnnotation]; params != "" {
+		if err := json.Unmarshal([]byte(params), &existing.Parameters); err != nil {
+			return nil, fmt.Errorf("parse %s annotation of %s: %w", parametersAnnotation, appFile, err)
+		}
+	}
+
+	if raw, err := files.readFile(path.Join(d.cfg.ManifestPath, appName, "ingress.yaml")); err == nil {
+		existing.HasIngress = true
+		d.readIngressOptions(existing, raw, d.appHost(appName))
+	}
+	if raw, err := files.readFile(path.Join(d.cfg.ManifestPath, appName, appNetworkPolicyFile)); err == nil {
+		existing.AllowedCIDRs = networkPolicyCIDRs(raw)
+	}
+	if raw, err := files.readFile(path.Join(d.cfg.ManifestPath, appName, egressNetworkPolicyFile)); err == nil {
+		existing.Egress = egressFromNetworkPolicy(raw)
+	}
+	if raw, err := files.readFile(path.Join(d.cfg.ManifestPath, appName, basicAuthFile)); err == nil {
+		existing.BasicAuth = basicAuthHtpasswd(raw)
+	}
+
+	existing.Image = "unknown"
+	for _, source := range []string{sourceCronJob, sourceJob, sourceImage} {
+		raw, err := files.readFile(path.Join(d.cfg.ManifestPath, appName, workloadFiles[source]))
+		if err != nil {
+			continue
+		}
+		existing.Source = source
+		if image := firstContainerImage(raw); image != "" {
+			existing.Image = image
+		}
+		break
+	}
+	return existing, nil
+}
+
+// firstContainerImage returns the image of the first container of the
+// Deployment, CronJob or Job in raw, or "" if it has none.
+func firstContainerImage(raw []byte) string {
+	var obj unstructured.Unstructured
+	if err := yaml.Unmarshal(raw, &obj.Object); err != nil {
+		return ""
+	}
+	podSpec := []string{"spec", "template", "spec"}
+	if obj.GetKind() == "CronJob" {
+		podSpec = []string{"spec", "jobTemplate", "spec", "template", "spec"}
+	}
+	containers, _, _ := unstructured.NestedSlice(obj.Object, append(podSpec, "containers")...)
+	if len(containers) == 0 {
+		return ""
+	}
+	c, _ := containers[0].(map[string]interface{})
+	image, _ := c["image"].(string)
+	return image
+}
+
+// prepareDeploy checks that the caller may deploy req over whatever already
+// exists in ws, according to req.Mode, and returns the ownership to render.
+// In replace mode it also stages the removal of the existing app's files; in
+// upgrade mode it fills in the profile, parameters, Ingress and TLS options
+// and authentication not given from the existing app's.
+func (d *Deployer) prepareDeploy(ws *workspace, c caller, req *deployRequest, source string) (Ownership, error) {
+	existing, err := d.readExistingApp(ws, req.AppName)
+	if err != nil {
+		return Ownership{}, err
+	}
+	if existing == nil {
+		if req.Mode == modeUpgrade {
+			return Ownership{}, fmt.Errorf("app %s does not exist; deploy it with mode=%s", req.AppName, modeCreate)
+		}
+		return Ownership{}.claim(c, req.Protected), nil
+	}
+
+	if err := existing.authorize(c, req.AppName); err != nil {
+		return Ownership{}, err
+	}
+
+	switch req.Mode {
+	case modeCreate, "":
+		return Ownership{}, fmt.Errorf("app %s already exists (%s); pass mode=%s to change its image or chart, or mode=%s to replace it", req.AppName, existing, modeUpgrade, modeReplace)
+	case modeUpgrade:
+		if existing.Source != source {
+			return Ownership{}, fmt.Errorf("app %s is deployed from %s; upgrading it from a %s would change its source type, use mode=%s", req.AppName, existing, source, modeReplace)
+		}
+		if existing.Namespace != req.Namespace {
+			return Ownership{}, fmt.Errorf("app %s is deployed in namespace %s; upgrading it would move it to %s, use set-exposure or mode=%s", req.AppName, existing.Namespace, req.Namespace, modeReplace)
+		}
+		if source == sourceImage && req.Profile == "" {
+			req.Profile = existing.Profile
+		}
+		if source == sourceImage && existing.Profile != req.Profile {
+			return Ownership{}, fmt.Errorf("app %s is deployed with profile %s; upgrading it to profile %s could leave manifests behind, use mode=%s", req.AppName, existing.Profile, req.Profile, modeReplace)
+		}
+		if req.Parameters == nil {
+			req.Parameters = existing.Parameters
+		}
+		if req.Aliases == nil {
+			req.Aliases = existing.Aliases
+		}
+		if req.Path == "" {
+			req.Path = existing.Path
+		}
+		if req.IngressAnnotations == nil {
+			req.IngressAnnotations = existing.IngressAnnotations
+		}
+		if req.AllowedCIDRs == nil {
+			req.AllowedCIDRs = existing.AllowedCIDRs
+		}
+		if req.Egress == nil {
+			req.Egress = existing.Egress
+		}
+		if req.TLS == nil && existing.HasIngress {
+			tls := existing.TLS
+			req.TLS = &tls
+		}
+		// Authentication and exposure=none are only dropped by asking for
+		// another exposure, and a basic auth password stays the same.
+		if existing.Auth != "" && !req.ExposureGiven {
+			req.Exposure = exposureAuthenticated
+		}
+		if !req.ExposureGiven && !existing.HasIngress {
+			req.Exposure = exposureNone
+			if req.Aliases != nil || req.Path != "" || req.IngressAnnotations != nil {
+				return Ownership{}, fmt.Errorf("app %s has no Ingress; pass exposure=%s to give it one with these hosts, path or ingress_annotations", req.AppName, exposurePublic)
+			}
+		}
+		if req.Exposure == exposureAuthenticated && req.Auth == "" {
+			req.Auth = existing.Auth
+		}
+		if d.authMethod(*req) == authBasic {
+			req.BasicAuth = existing.BasicAuth
+		}
+	case modeReplace:
+		if err := ws.removeAll(path.Join(d.cfg.ManifestPath, req.AppName)); err != nil {
+			return Ownership{}, err
+		}
+		if err := ws.removeAll(d.argoAppFile(req.AppName)); err != nil {
+			return Ownership{}, err
+		}
+		if err := ws.removeAll(path.Join(generatedDir, req.AppName)); err != nil {
+			return Ownership{}, err
+		}
+	}
+	return existing.claim(c, req.Protected), nil
+}
+
+// readOwnership returns the ownership recorded on an app's ArgoCD Application
+// in the checkout, and whether the app exists at all.
+func (d *Deployer) readOwnership(ws *workspace, appName string) (Ownership, bool, error) {
+	existing, err := d.readExistingApp(ws, appName)
+	if err != nil || existing == nil {
+		return Ownership{}, false, err
+	}
+	return existing.Ownership, true, nil
+}
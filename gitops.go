@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// GitRepository is the GitOps repository that manifests and ArgoCD
+// Applications are committed to.
+type GitRepository interface {
+	// URL is the repository address written into ArgoCD Applications.
+	URL() string
+	// Clone checks out the default branch into dir.
+	Clone(ctx context.Context, dir string) (*git.Repository, error)
+	// Push publishes commits made on a repository returned by Clone.
+	Push(ctx context.Context, repo *git.Repository) error
+	// HeadTree returns the tree of the default branch without a working copy.
+	HeadTree(ctx context.Context) (*object.Tree, error)
+}
+
+// remoteGitRepository talks to a repository over any transport supported by
+// go-git: HTTPS with a token for GitHub, or a plain path / file:// URL for a
+// local bare repository.
+type remoteGitRepository struct {
+	url  string
+	auth transport.AuthMethod
+}
+
+func newRemoteGitRepository(url, token string) *remoteGitRepository {
+	r := &remoteGitRepository{url: url}
+	if token != "" {
+		r.auth = &githttp.BasicAuth{
+			Username: "oauth2", // Common for tokens
+			Password: token,
+		}
+	}
+	return r
+}
+
+func (r *remoteGitRepository) URL() string {
+	return r.url
+}
+
+func (r *remoteGitRepository) Clone(ctx context.Context, dir string) (*git.Repository, error) {
+	return git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:  r.url,
+		Auth: r.auth,
+	})
+}
+
+func (r *remoteGitRepository) Push(ctx context.Context, repo *git.Repository) error {
+	return repo.PushContext(ctx, &git.PushOptions{Auth: r.auth})
+}
+
+func (r *remoteGitRepository) HeadTree(ctx context.Context) (*object.Tree, error) {
+	// We use an in-memory clone for speed, just checking existence
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+		URL:   r.url,
+		Auth:  r.auth,
+		Depth: 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return commit.Tree()
+}
+
+// workspace is a temporary checkout of the GitOps repository in which a tool
+// stages its changes before committing them.
+type workspace struct {
+	dir  string
+	repo *git.Repository
+	w    *git.Worktree
+}
+
+// checkout clones the GitOps repository into a new temporary directory. The
+// caller must call close when done.
+func (d *Deployer) checkout(ctx context.Context) (*workspace, error) {
+	dir, err := os.MkdirTemp("", "mcp-deployer-")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+
+	repo, err := d.repo.Clone(ctx, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("clone repo: %w", err)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("get worktree: %w", err)
+	}
+
+	return &workspace{dir: dir, repo: repo, w: w}, nil
+}
+
+func (ws *workspace) close() {
+	os.RemoveAll(ws.dir)
+}
+
+// abs returns the absolute path of a slash-separated repository path. It
+// refuses paths that would resolve outside the checkout, as a last line of
+// defence behind validateAppName.
+func (ws *workspace) abs(rel string) (string, error) {
+	clean := path.Clean(rel)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path %q escapes the repository", rel)
+	}
+	return filepath.Join(ws.dir, filepath.FromSlash(clean)), nil
+}
+
+// writeFile writes content to a repository path, creating parent
+// directories, and stages it.
+func (ws *workspace) writeFile(rel string, content []byte) error {
+	abs, err := ws.abs(rel)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return fmt.Errorf("create dir for %s: %w", rel, err)
+	}
+	if err := os.WriteFile(abs, content, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", rel, err)
+	}
+	if _, err := ws.w.Add(rel); err != nil {
+		return fmt.Errorf("git add %s: %w", rel, err)
+	}
+	return nil
+}
+
+// readFile returns the content of a repository path in the checkout. A
+// missing file yields an error satisfying os.IsNotExist.
+func (ws *workspace) readFile(rel string) ([]byte, error) {
+	abs, err := ws.abs(rel)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(abs)
+}
+
+// repoFiles reads files from one version of the GitOps repository: a
+// workspace, or treeFiles for the tree at HEAD.
+type repoFiles interface {
+	readFile(rel string) ([]byte, error)
+	// listDir returns the sorted names of the entries of a directory, or
+	// none if it does not exist.
+	listDir(rel string) ([]string, error)
+}
+
+// treeFiles reads files from a commit tree.
+type treeFiles struct {
+	*object.Tree
+}
+
+// readFile returns the content of a repository path in the tree. A missing
+// file yields an error satisfying os.IsNotExist.
+func (t treeFiles) readFile(rel string) ([]byte, error) {
+	f, err := t.File(rel)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, &fs.PathError{Op: "read", Path: rel, Err: fs.ErrNotExist}
+	} else if err != nil {
+		return nil, err
+	}
+	content, err := f.Contents()
+	return []byte(content), err
+}
+
+func (t treeFiles) listDir(rel string) ([]string, error) {
+	dir, err := t.Tree.Tree(rel)
+	if errors.Is(err, object.ErrDirectoryNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(dir.Entries))
+	for i, e := range dir.Entries {
+		names[i] = e.Name
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+func (ws *workspace) listDir(rel string) ([]string, error) {
+	abs, err := ws.abs(rel)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(abs)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names, nil
+}
+
+// exists reports whether a repository path is present in the checkout.
+func (ws *workspace) exists(rel string) bool {
+	abs, err := ws.abs(rel)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(abs)
+	return err == nil
+}
+
+// removeAll deletes a file or directory from the checkout and stages the
+// deletion. Missing paths are ignored.
+func (ws *workspace) removeAll(rel string) error {
+	abs, err := ws.abs(rel)
+	if err != nil {
+		return err
+	}
+	if !ws.exists(rel) {
+		return nil
+	}
+	if err := os.RemoveAll(abs); err != nil {
+		return fmt.Errorf("remove %s: %w", rel, err)
+	}
+	// go-git's Remove is file based; staging everything picks up the deleted
+	// directory contents in one go.
+	if err := ws.w.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		return fmt.Errorf("stage removal of %s: %w", rel, err)
+	}
+	return nil
+}
+
+// errNoChanges is returned by commitAndPush when there is nothing to commit.
+var errNoChanges = errors.New("no changes")
+
+// commitAndPush commits everything staged in ws and pushes it to the GitOps
+// repository. It returns errNoChanges if the worktree is clean.
+func (d *Deployer) commitAndPush(ctx context.Context, ws *workspace, msg string) error {
+	status, err := ws.w.Status()
+	if err != nil {
+		return fmt.Errorf("get git status: %w", err)
+	}
+
+	if status.IsClean() {
+		return errNoChanges
+	}
+
+	if _, err := ws.commit(msg); err != nil {
+		return err
+	}
+
+	if err := d.repo.Push(ctx, ws.repo); err != nil {
+		return fmt.Errorf("push changes: %w", err)
+	}
+
+	return nil
+}
+
+func (ws *workspace) commit(msg string) (*object.Commit, error) {
+	hash, err := ws.w.Commit(msg, &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "MCP App Deployer",
+			Email: "mcp-deployer@bot.local",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("commit changes: %w", err)
+	}
+	return ws.repo.CommitObject(hash)
+}
+
+// diff returns everything staged in ws as a unified diff against HEAD, or
+// errNoChanges if the worktree is clean. go-git can only diff commits, so the
+// changes are committed in the throwaway checkout; that commit is never
+// pushed.
+func (ws *workspace) diff() (string, error) {
+	status, err := ws.w.Status()
+	if err != nil {
+		return "", fmt.Errorf("get git status: %w", err)
+	}
+	if status.IsClean() {
+		return "", errNoChanges
+	}
+
+	head, err := ws.repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("resolve HEAD: %w", err)
+	}
+	base, err := ws.repo.CommitObject(head.Hash())
+	if err != nil {
+		return "", fmt.Errorf("read HEAD commit: %w", err)
+	}
+	planned, err := ws.commit("dry run")
+	if err != nil {
+		return "", err
+	}
+
+	patch, err := base.Patch(planned)
+	if err != nil {
+		return "", fmt.Errorf("diff against HEAD: %w", err)
+	}
+	return patch.String(), nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
+)
+
+// harness runs the MCP server in-process against a file:// bare repository,
+// client-go fakes driven by fakeArgoCD and an httptest server standing in
+// for every ingress host.
+type harness struct {
+	t      *testing.T
+	client *client.Client
+	d      *Deployer
+	argo   *fakeArgoCD
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	repo := newRemoteGitRepository("file://"+newTestRepo(t), "")
+	kube := kubefake.NewSimpleClientset()
+	dyn := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{argoApplicationGVR: "ApplicationList", certificateGVR: "CertificateList"},
+	)
+
+	d := NewDeployer(newTestConfig(), repo, kube, dyn)
+	d.pollInterval = 10 * time.Millisecond
+	d.argoTimeout = 5 * time.Second
+	d.ingressTimeout = 5 * time.Second
+
+	argo := &fakeArgoCD{t: t, d: d, kube: kube, polls: map[string]int{}}
+	dyn.PrependReactor("get", "applications", argo.get)
+
+	ingress := httptest.NewServer(http.HandlerFunc(argo.serveIngress))
+	t.Cleanup(ingress.Close)
+	d.httpClient = &http.Client{
+		Timeout: time.Second,
+		Transport: &http.Transport{
+			// Every ingress host resolves to the test server. TLS
+			// handshakes against it fail, so probes fall back to http.
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, ingress.Listener.Addr().String())
+			},
+		},
+	}
+
+	cli, err := client.NewInProcessClient(newMCPServer(d))
+	if err != nil {
+		t.Fatalf("create in-process client: %v", err)
+	}
+	t.Cleanup(func() { cli.Close() })
+
+	ctx := context.Background()
+	if err := cli.Start(ctx); err != nil {
+		t.Fatalf("start client: %v", err)
+	}
+	if _, err := cli.Initialize(ctx, mcp.InitializeRequest{
+		Params: mcp.InitializeParams{
+			ProtocolVersion: mcp.LATEST_PROTOCOL_VERSION,
+			ClientInfo:      mcp.Implementation{Name: "harness", Version: "1.0.0"},
+		},
+	}); err != nil {
+		t.Fatalf("initialize client: %v", err)
+	}
+
+	return &harness{t: t, client: cli, d: d, argo: argo}
+}
+
+// call invokes a tool and returns its text output. It fails the test if the
+// tool result's error flag does not match wantErr.
+func (h *harness) call(tool string, args map[string]interface{}, wantErr bool) string {
+	h.t.Helper()
+	res, err := h.client.CallTool(context.Background(), mcp.CallToolRequest{
+		Params: mcp.CallToolParams{Name: tool, Arguments: args},
+	})
+	if err != nil {
+		h.t.Fatalf("%s: %v", tool, err)
+	}
+	printResult(h.t, tool, res)
+	if res.IsError != wantErr {
+		h.t.Fatalf("%s: IsError = %v, want %v:\n%s", tool, res.IsError, wantErr, resultText(res))
+	}
+	return resultText(res)
+}
+
+// fakeArgoCD simulates the ArgoCD controller. An Application exists while its
+// file is present in the GitOps repository; the first time it is observed it
+// reports Progressing/OutOfSync and from then on Healthy/Synced, at which
+// point Deployments from Git-sourced apps are applied to the fake clientset
+// and the app's ingress host starts answering.
+type fakeArgoCD struct {
+	t    *testing.T
+	d    *Deployer
+	kube *kubefake.Clientset
+
+	mu    sync.Mutex
+	polls map[string]int
+}
+
+func (f *fakeArgoCD) get(action k8stesting.Action) (bool, runtime.Object, error) {
+	name := action.(k8stesting.GetAction).GetName()
+
+	tree, err := f.d.repo.HeadTree(context.Background())
+	if err != nil {
+		return true, nil, err
+	}
+	file, err := tree.File(f.d.argoAppFile(name))
+	if err != nil {
+		f.mu.Lock()
+		delete(f.polls, name)
+		f.mu.Unlock()
+		return true, nil, apierrors.NewNotFound(argoApplicationGVR.GroupResource(), name)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return true, nil, err
+	}
+	app := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(content), &app.Object); err != nil {
+		return true, nil, err
+	}
+
+	f.mu.Lock()
+	f.polls[name]++
+	synced := f.polls[name] > 1
+	f.mu.Unlock()
+
+	health, sync := "Progressing", "OutOfSync"
+	if synced {
+		health, sync = "Healthy", "Synced"
+		f.applyDeployment(app)
+	}
+	app.Object["status"] = map[string]interface{}{
+		"health": map[string]interface{}{"status": health},
+		"sync":   map[string]interface{}{"status": sync},
+	}
+	return true, app, nil
+}
+
+// applyDeployment creates the Deployment of a Git-sourced Application in the
+// fake clientset, as ArgoCD would when syncing.
+func (f *fakeArgoCD) applyDeployment(app *unstructured.Unstructured) {
+	sourcePath, found, _ := unstructured.NestedString(app.Object, "spec", "source", "path")
+	if !found {
+		return
+	}
+	tree, err := f.d.repo.HeadTree(context.Background())
+	if err != nil {
+		f.t.Errorf("fake argocd: read tree: %v", err)
+		return
+	}
+	file, err := tree.File(path.Join(sourcePath, "deployment.yaml"))
+	if err != nil {
+		return
+	}
+	content, _ := file.Contents()
+	var deployment appsv1.Deployment
+	if err := yaml.Unmarshal([]byte(content), &deployment); err != nil {
+		f.t.Errorf("fake argocd: decode deployment: %v", err)
+		return
+	}
+	deployments := f.kube.AppsV1().Deployments(deployment.Namespace)
+	if _, err := deployments.Get(context.Background(), deployment.Name, metav1.GetOptions{}); err == nil {
+		return
+	}
+	if _, err := deployments.Create(context.Background(), &deployment, metav1.CreateOptions{}); err != nil {
+		f.t.Errorf("fake argocd: create deployment: %v", err)
+	}
+}
+
+// serveIngress answers for <app>.<domain> once the app has synced.
+func (f *fakeArgoCD) serveIngress(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	appName := strings.TrimSuffix(host, "."+f.d.cfg.Domain)
+
+	f.mu.Lock()
+	synced := f.polls[appName] > 1
+	f.mu.Unlock()
+
+	if !synced {
+		http.Error(w, "no backend", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
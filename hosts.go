@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// ingressRoute is a host and path prefix an Ingress routes to an app.
+type ingressRoute struct {
+	Host string
+	Path string
+}
+
+func (r ingressRoute) String() string {
+	if r.Path == "/" {
+		return r.Host
+	}
+	return r.Host + r.Path
+}
+
+func compareRoutes(a, b ingressRoute) int {
+	if c := strings.Compare(a.Host, b.Host); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// renderedRoutes returns the routes of the Ingresses among files, and the
+// hosts of a Helm app's ArgoCD Application.
+func renderedRoutes(files []renderedFile) []ingressRoute {
+	var routes []ingressRoute
+	for _, f := range files {
+		for _, obj := range f.Objects {
+			switch o := obj.(type) {
+			case *networkingv1.Ingress:
+				routes = append(routes, ingressObjectRoutes(o)...)
+			case *unstructured.Unstructured:
+				if o.GetKind() == "Application" {
+					routes = append(routes, helmRoutes(o)...)
+				}
+			}
+		}
+	}
+	return routes
+}
+
+func ingressObjectRoutes(ingress *networkingv1.Ingress) []ingressRoute {
+	var routes []ingressRoute
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil || len(rule.HTTP.Paths) == 0 {
+			routes = append(routes, ingressRoute{Host: rule.Host, Path: "/"})
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			routes = append(routes, ingressRoute{Host: rule.Host, Path: path.Clean("/" + p.Path)})
+		}
+	}
+	return routes
+}
+
+// manifestRoutes returns the routes of every Ingress in a manifest file.
+// Documents that do not parse are skipped: ArgoCD cannot apply them either.
+func manifestRoutes(raw []byte) []ingressRoute {
+	var routes []ingressRoute
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(raw)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return routes
+		}
+		var obj unstructured.Unstructured
+		if yaml.Unmarshal(doc, &obj.Object) != nil || obj.GetKind() != "Ingress" {
+			continue
+		}
+		var ingress networkingv1.Ingress
+		if yaml.Unmarshal(doc, &ingress) == nil {
+			routes = append(routes, ingressObjectRoutes(&ingress)...)
+		}
+	}
+	return routes
+}
+
+// helmExtraHostParam matches the Helm parameters naming an extra host of a
+// chart following the Bitnami layout, and its path.
+var helmExtraHostParam = regexp.MustCompile(`^ingress\.extraHosts\[(\d+)\]\.(name|path)$`)
+
+// helmRoutes returns the hosts a Helm app's Ingress serves, as far as the
+// values and parameters of its ArgoCD Application name them:
+// ingress.host (set by the deployer), ingress.hostname (the Bitnami
+// convention) and ingress.extraHosts[], on ingress.path or the extra host's
+// path. Hosts that only come from the chart's defaults are not known.
+func helmRoutes(app *unstructured.Unstructured) []ingressRoute {
+	ingress := map[string]interface{}{}
+	if raw, ok, _ := unstructured.NestedString(app.Object, "spec", "source", "helm", "values"); ok {
+		var values map[string]interface{}
+		if yaml.Unmarshal([]byte(raw), &values) == nil {
+			if v, ok := values["ingress"].(map[string]interface{}); ok {
+				ingress = v
+			}
+		}
+	}
+	if v, ok, _ := unstructured.NestedMap(app.Object, "spec", "source", "helm", "valuesObject", "ingress"); ok {
+		for k, val := range v {
+			ingress[k] = val
+		}
+	}
+
+	extraHosts := map[int]map[string]interface{}{}
+	if list, ok := ingress["extraHosts"].([]interface{}); ok {
+		for i, item := range list {
+			if host, ok := item.(map[string]interface{}); ok {
+				extraHosts[i] = host
+			}
+		}
+	}
+
+	params, _, _ := unstructured.NestedSlice(app.Object, "spec", "source", "helm", "parameters")
+	for _, p := range params {
+		param, _ := p.(map[string]interface{})
+		name, _ := param["name"].(string)
+		value, _ := param["value"].(string)
+		switch name {
+		case "ingress.enabled", "ingress.host", "ingress.hostname", "ingress.path":
+			ingress[strings.TrimPrefix(name, "ingress.")] = value
+		default:
+			if m := helmExtraHostParam.FindStringSubmatch(name); m != nil {
+				i, _ := strconv.Atoi(m[1])
+				if extraHosts[i] == nil {
+					extraHosts[i] = map[string]interface{}{}
+				}
+				extraHosts[i][m[2]] = value
+			}
+		}
+	}
+
+	if fmt.Sprint(ingress["enabled"]) == "false" {
+		return nil
+	}
+	var routes []ingressRoute
+	route := func(host, p interface{}) {
+		h, _ := host.(string)
+		prefix, _ := p.(string)
+		if h != "" {
+			routes = append(routes, ingressRoute{Host: h, Path: path.Clean("/" + prefix)})
+		}
+	}
+	route(ingress["host"], ingress["path"])
+	route(ingress["hostname"], ingress["path"])
+	indices := make([]int, 0, len(extraHosts))
+	for i := range extraHosts {
+		indices = append(indices, i)
+	}
+	slices.Sort(indices)
+	for _, i := range indices {
+		route(extraHosts[i]["name"], extraHosts[i]["path"])
+	}
+	return routes
+}
+
+// deployedRoutes returns the routes of every app deployed in files, keyed by
+// app name: those of each Ingress in the manifests of Git-sourced apps, and
+// the hosts of Helm apps.
+func (d *Deployer) deployedRoutes(files repoFiles) (map[string][]ingressRoute, error) {
+	names, err := files.listDir(d.cfg.ArgoCDAppPath)
+	if err != nil {
+		return nil, err
+	}
+	routes := map[string][]ingressRoute{}
+	for _, name := range names {
+		appName, ok := strings.CutSuffix(name, ".yaml")
+		if !ok || reservedAppNames[appName] {
+			continue
+		}
+		raw, err := files.readFile(d.argoAppFile(appName))
+		if err != nil {
+			return nil, err
+		}
+		var app unstructured.Unstructured
+		if err := yaml.Unmarshal(raw, &app.Object); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", d.argoAppFile(appName), err)
+		}
+		if _, isHelm, _ := unstructured.NestedString(app.Object, "spec", "source", "chart"); isHelm {
+			routes[appName] = helmRoutes(&app)
+			continue
+		}
+
+		dir, _, _ := unstructured.NestedString(app.Object, "spec", "source", "path")
+		if dir == "" {
+			continue
+		}
+		manifests, err := files.listDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range manifests {
+			if path.Ext(m) != ".yaml" && path.Ext(m) != ".yml" {
+				continue
+			}
+			raw, err := files.readFile(path.Join(dir, m))
+			if err != nil {
+				continue
+			}
+			routes[appName] = append(routes[appName], manifestRoutes(raw)...)
+		}
+	}
+	return routes, nil
+}
+
+// routeOwners inverts deployedRoutes: the apps routed each host and path,
+// sorted by name.
+func routeOwners(deployed map[string][]ingressRoute) map[ingressRoute][]string {
+	owners := map[ingressRoute][]string{}
+	for appName, routes := range deployed {
+		for _, r := range routes {
+			if !slices.Contains(owners[r], appName) {
+				owners[r] = append(owners[r], appName)
+			}
+		}
+	}
+	for _, apps := range owners {
+		slices.Sort(apps)
+	}
+	return owners
+}
+
+// checkRoutes fails if any of routes, rendered for appName on behalf of c,
+// is already routed to another app in files. Apps may share a host on
+// different paths, but only with apps c may change, so that nobody can route
+// a path below someone else's app to their own. For the same reason the own
+// host of an app c may not change is refused, even if it has no Ingress.
+func (d *Deployer) checkRoutes(files repoFiles, c caller, appName string, routes []ingressRoute) error {
+	deployed, err := d.deployedRoutes(files)
+	if err != nil {
+		return fmt.Errorf("read ingress hosts: %w", err)
+	}
+	delete(deployed, appName)
+	owners := routeOwners(deployed)
+	hostApps := map[string][]string{}
+	for other, otherRoutes := range deployed {
+		for _, r := range otherRoutes {
+			if !slices.Contains(hostApps[r.Host], other) {
+				hostApps[r.Host] = append(hostApps[r.Host], other)
+			}
+		}
+	}
+
+	for _, r := range routes {
+		if apps := owners[r]; len(apps) > 0 {
+			return fmt.Errorf("%s is already routed to app %s; choose another host or path", r, apps[0])
+		}
+		others := slices.Clone(hostApps[r.Host])
+		if name, ok := strings.CutSuffix(r.Host, "."+d.cfg.Domain); ok && name != appName && !strings.Contains(name, ".") && !slices.Contains(others, name) {
+			others = append(others, name)
+		}
+		slices.Sort(others)
+		for _, other := range others {
+			existing, err := d.readExistingApp(files, other)
+			if err != nil {
+				return fmt.Errorf("read app %s: %w", other, err)
+			}
+			if existing == nil {
+				continue
+			}
+			if err := existing.authorize(c, other); err != nil {
+				return fmt.Errorf("host %s belongs to app %s, which you may not change (%v); choose another host", r.Host, other, err)
+			}
+		}
+	}
+	return nil
+}
+
+// hosts lists every host and path routed to an app at HEAD, flagging those
+// claimed by more than one app.
+func (d *Deployer) hosts(ctx context.Context) (*mcp.CallToolResult, error) {
+	tree, err := d.repo.HeadTree(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read repository: %v", err)), nil
+	}
+	deployed, err := d.deployedRoutes(treeFiles{tree})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read ingress hosts: %v", err)), nil
+	}
+	owners := routeOwners(deployed)
+	if len(owners) == 0 {
+		return mcp.NewToolResultText("No ingress hosts in Git"), nil
+	}
+
+	routes := make([]ingressRoute, 0, len(owners))
+	for r := range owners {
+		routes = append(routes, r)
+	}
+	slices.SortFunc(routes, compareRoutes)
+	result := []string{"Ingress hosts in Git:"}
+	for _, r := range routes {
+		line := fmt.Sprintf("%s → %s", r, strings.Join(owners[r], ", "))
+		if len(owners[r]) > 1 {
+			line = "⚠️ " + line + " (conflict)"
+		}
+		result = append(result, line)
+	}
+	return mcp.NewToolResultText(strings.Join(result, "\n")), nil
+}
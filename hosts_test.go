@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestHelmRoutes(t *testing.T) {
+	param := func(name, value string) interface{} {
+		return map[string]interface{}{"name": name, "value": value}
+	}
+	tests := []struct {
+		name string
+		helm map[string]interface{}
+		want []ingressRoute
+	}{
+		{
+			name: "deployer parameters",
+			helm: map[string]interface{}{"parameters": []interface{}{param("ingress.name", "demo"), param("ingress.host", "demo.example.com")}},
+			want: []ingressRoute{{"demo.example.com", "/"}},
+		},
+		{
+			name: "values and extra hosts",
+			helm: map[string]interface{}{
+				"values": "ingress:\n  hostname: shop.example.org\n  path: /shop\n  extraHosts:\n  - name: www.shop.example.org\n",
+				"parameters": []interface{}{
+					param("ingress.extraHosts[1].name", "api.shop.example.org"),
+					param("ingress.extraHosts[1].path", "/api"),
+				},
+			},
+			want: []ingressRoute{{"shop.example.org", "/shop"}, {"www.shop.example.org", "/"}, {"api.shop.example.org", "/api"}},
+		},
+		{
+			name: "parameters override valuesObject",
+			helm: map[string]interface{}{
+				"valuesObject": map[string]interface{}{"ingress": map[string]interface{}{"hostname": "old.example.org"}},
+				"parameters":   []interface{}{param("ingress.hostname", "new.example.org")},
+			},
+			want: []ingressRoute{{"new.example.org", "/"}},
+		},
+		{
+			name: "ingress disabled",
+			helm: map[string]interface{}{
+				"valuesObject": map[string]interface{}{"ingress": map[string]interface{}{"enabled": false, "hostname": "shop.example.org"}},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := &unstructured.Unstructured{Object: map[string]interface{}{
+				"kind": "Application",
+				"spec": map[string]interface{}{"source": map[string]interface{}{"chart": "nginx", "helm": test.helm}},
+			}}
+			if got := helmRoutes(app); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("helmRoutes() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestHostCollisionsAndHostsTool(t *testing.T) {
+	h := newHarness(t)
+
+	if out := h.call("hosts", map[string]interface{}{}, false); out != "No ingress hosts in Git" {
+		t.Fatalf("unexpected hosts output: %s", out)
+	}
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.27"}, false)
+	h.call("deploy-helmchart", map[string]interface{}{"app_name": "legacy", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0"}, false)
+
+	// Hosts set by hand, in the values of a Helm app or in an extra
+	// Ingress, are claimed as well.
+	editRepoFile(t, h.d, "argocd-apps/legacy.yaml", func(s string) string {
+		return strings.Replace(s, "releaseName: legacy\n", "releaseName: legacy\n      valuesObject:\n        ingress:\n          hostname: shop.example.org\n", 1)
+	})
+	editRepoFile(t, h.d, "manifests/web/ingress.yaml", func(s string) string {
+		return s + `---
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web-docs
+spec:
+  rules:
+  - host: docs.example.org
+    http:
+      paths:
+      - path: /guide/
+        pathType: Prefix
+        backend:
+          service:
+            name: web
+            port:
+              number: 80
+`
+	})
+
+	for _, test := range []struct {
+		host, path, want string
+	}{
+		{"shop.example.org", "/", "shop.example.org is already routed to app legacy"},
+		{"docs.example.org", "/guide", "docs.example.org/guide is already routed to app web"},
+		{"web.example.com", "/", "web.example.com is already routed to app web"},
+	} {
+		args := map[string]interface{}{"app_name": "intruder", "image": "nginx:1.27", "hosts": []interface{}{test.host}, "path": test.path}
+		if out := h.call("deploy-image", args, true); !strings.Contains(out, test.want) {
+			t.Errorf("deploying over %s%s: got %q, want %q", test.host, test.path, out, test.want)
+		}
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "docs", "image": "nginx:1.27", "hosts": []interface{}{"docs.example.org"}}, false)
+
+	want := strings.Join([]string{
+		"Ingress hosts in Git:",
+		"docs.example.com → docs",
+		"docs.example.org → docs",
+		"docs.example.org/guide → web",
+		"legacy.example.com → legacy",
+		"shop.example.org → legacy",
+		"web.example.com → web",
+	}, "\n")
+	if out := h.call("hosts", map[string]interface{}{}, false); out != want {
+		t.Fatalf("hosts output:\n%s\nwant:\n%s", out, want)
+	}
+
+	// A collision committed by hand is flagged.
+	editRepoFile(t, h.d, "manifests/docs/ingress.yaml", func(s string) string {
+		return strings.Replace(s, "- host: docs.example.org", "- host: shop.example.org", 1)
+	})
+	if out := h.call("hosts", map[string]interface{}{}, false); !strings.Contains(out, "⚠️ shop.example.org → docs, legacy (conflict)") {
+		t.Fatalf("hosts did not flag the conflict:\n%s", out)
+	}
+}
+
+func TestRouteTakeover(t *testing.T) {
+	d, _ := newTestDeployer(t, nil)
+	alice := withCaller(context.Background(), caller{Name: "alice"})
+	bob := withCaller(context.Background(), caller{Name: "bob"})
+	deploy := func(ctx context.Context, appName, exposure string, aliases []string, path string) *mcp.CallToolResult {
+		t.Helper()
+		req := deployRequest{AppName: appName, Exposure: exposure, Namespace: d.cfg.Namespace, Aliases: aliases, Path: path}
+		return must(t)(d.deploy(ctx, req, "nginx:1.27"))
+	}
+
+	if res := deploy(alice, "shop", exposurePublic, []string{"shop.example.org"}, ""); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+	if res := deploy(alice, "quiet", exposureNone, nil, ""); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+
+	for _, test := range []struct {
+		name, host, want string
+	}{
+		{"subpath of an alias", "shop.example.org", "host shop.example.org belongs to app shop"},
+		{"subpath of an app host", "shop.example.com", "host shop.example.com belongs to app shop"},
+		{"app host without an Ingress", "quiet.example.com", "host quiet.example.com belongs to app quiet"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			res := deploy(bob, "intruder", exposurePublic, []string{test.host}, "/admin")
+			if !res.IsError || !strings.Contains(resultText(res), test.want) || !strings.Contains(resultText(res), "owned by alice") {
+				t.Fatalf("takeover of %s/admin = %s", test.host, resultText(res))
+			}
+		})
+	}
+
+	// The owner may route paths of their own hosts to another app.
+	if res := deploy(alice, "api", exposurePublic, []string{"shop.example.org"}, "/api"); res.IsError {
+		t.Fatalf("owner sharing a host failed: %s", resultText(res))
+	}
+}
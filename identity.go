@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// caller is the identity a tool call is made with. Over HTTP it is the user
+// whose bearer token authenticated the request; over stdio it is the local
+// operator, who has admin rights.
+type caller struct {
+	Name  string
+	Admin bool
+}
+
+var (
+	stdioCaller = caller{Name: "stdio", Admin: true}
+	// passwordCaller is the identity of the shared --http-password, which
+	// predates per-user tokens and therefore keeps full rights as long as no
+	// --http-users-file is configured.
+	passwordCaller = caller{Name: "admin", Admin: true}
+	// sharedPasswordCaller is the identity of the shared --http-password
+	// alongside per-user tokens. It is an ordinary user, so that holders of
+	// the shared password cannot override the ownership of other users' apps.
+	sharedPasswordCaller = caller{Name: "shared-password"}
+)
+
+type callerKey struct{}
+
+func withCaller(ctx context.Context, c caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+// callerFrom returns the identity attached to ctx by the HTTP auth
+// middleware, or the stdio operator if there is none.
+func callerFrom(ctx context.Context) caller {
+	if c, ok := ctx.Value(callerKey{}).(caller); ok {
+		return c
+	}
+	return stdioCaller
+}
+
+// httpUser is an entry of the --http-users-file.
+type httpUser struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Admin bool   `yaml:"admin"`
+}
+
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._@-]*$`)
+
+// loadHTTPUsers reads the per-user bearer tokens. An empty path returns no
+// users.
+func loadHTTPUsers(file string) ([]httpUser, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("read http-users-file: %w", err)
+	}
+	defer f.Close()
+
+	var doc struct {
+		Users []httpUser `yaml:"users"`
+	}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse http-users-file %s: %w", file, err)
+	}
+
+	var errs []error
+	names := map[string]bool{passwordCaller.Name: true, sharedPasswordCaller.Name: true, stdioCaller.Name: true}
+	tokens := map[string]bool{}
+	for i, u := range doc.Users {
+		if !userNamePattern.MatchString(u.Name) {
+			errs = append(errs, fmt.Errorf("users[%d]: name %q must match %s", i, u.Name, userNamePattern))
+		} else if names[u.Name] {
+			errs = append(errs, fmt.Errorf("users[%d]: name %q is reserved or already used", i, u.Name))
+		}
+		names[u.Name] = true
+		if u.Token == "" {
+			errs = append(errs, fmt.Errorf("users[%d]: token is required", i))
+		} else if tokens[u.Token] {
+			errs = append(errs, fmt.Errorf("users[%d]: token is already used by another user", i))
+		}
+		tokens[u.Token] = true
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("http-users-file %s: %w", file, err)
+	}
+	return doc.Users, nil
+}
+
+// authenticate returns the identity owning token. Every candidate is compared
+// in constant time. The shared password is only an admin without users.
+func authenticate(token, password string, users []httpUser) (caller, bool) {
+	var (
+		found caller
+		ok    bool
+	)
+	if password != "" && subtle.ConstantTimeCompare([]byte(token), []byte(password)) == 1 {
+		found, ok = passwordCaller, true
+		if len(users) > 0 {
+			found = sharedPasswordCaller
+		}
+	}
+	for _, u := range users {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(u.Token)) == 1 {
+			found, ok = caller{Name: u.Name, Admin: u.Admin}, true
+		}
+	}
+	return found, ok && token != ""
+}
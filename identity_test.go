@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAuthMiddlewareAttachesCaller(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.yaml")
+	writeFile(t, file, `
+users:
+  - name: alice
+    token: alice-token
+  - name: ops
+    token: ops-token
+    admin: true
+`)
+	users, err := loadHTTPUsers(file)
+	if err != nil {
+		t.Fatalf("loadHTTPUsers returned error: %v", err)
+	}
+
+	var got caller
+	handler := authMiddleware("shared", users, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = callerFrom(r.Context())
+	}))
+
+	tests := []struct {
+		token      string
+		wantStatus int
+		want       caller
+	}{
+		{token: "alice-token", wantStatus: http.StatusOK, want: caller{Name: "alice"}},
+		{token: "ops-token", wantStatus: http.StatusOK, want: caller{Name: "ops", Admin: true}},
+		{token: "shared", wantStatus: http.StatusOK, want: sharedPasswordCaller},
+		{token: "wrong", wantStatus: http.StatusUnauthorized},
+		{token: "", wantStatus: http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		got = caller{}
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer "+test.token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != test.wantStatus || got != test.want {
+			t.Fatalf("token %q: status %d caller %+v, want %d %+v", test.token, rec.Code, got, test.wantStatus, test.want)
+		}
+	}
+
+	// Without users the shared password keeps full rights.
+	if c, ok := authenticate("shared", "shared", nil); !ok || c != passwordCaller {
+		t.Fatalf("shared password without users = %+v, %v, want admin", c, ok)
+	}
+
+	if c := callerFrom(httptest.NewRequest(http.MethodGet, "/", nil).Context()); c != stdioCaller {
+		t.Fatalf("caller without HTTP identity = %+v, want stdio operator", c)
+	}
+}
+
+func TestLoadHTTPUsersRejectsInvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "users.yaml")
+	writeFile(t, file, `
+users:
+  - name: alice
+    token: same
+  - name: alice
+    token: same
+  - name: admin
+  - name: "bad name"
+    token: x
+`)
+	_, err := loadHTTPUsers(file)
+	for _, want := range []string{"already used", "token is already used", "users[2]: token is required", `"admin" is reserved`, "must match"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("error = %v, want it to contain %q", err, want)
+		}
+	}
+}
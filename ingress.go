@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// reservedAnnotationPrefixes are the annotation key prefixes the deployer
+// renders itself, which ingress_annotations may not set. The
+// --allowlist-annotation key is reserved as well.
+var reservedAnnotationPrefixes = []string{"mcp-app-deployer/", "cert-manager.io/", authAnnotationPrefix}
+
+// helmAnnotationParam prefixes the Helm parameter of each Ingress annotation
+// of a Helm app; dots in the annotation key are escaped with a backslash.
+const helmAnnotationParam = "ingress.annotations."
+
+// ingressPathSegment matches one segment of an ingress path prefix.
+var ingressPathSegment = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+
+// ingressRequestArgs extracts the hosts, path, ingress_annotations and auth
+// arguments of the deploy tools into req.
+func (d *Deployer) ingressRequestArgs(args map[string]interface{}, req *deployRequest) error {
+	if err := d.authArg(args, req); err != nil {
+		return err
+	}
+	aliases, err := stringListArg(args, "hosts")
+	if err != nil {
+		return err
+	}
+	if aliases != nil {
+		if req.Aliases, err = d.validateAliases(req.AppName, aliases); err != nil {
+			return err
+		}
+	}
+
+	if raw, ok := args["path"]; ok && raw != nil {
+		p, ok := raw.(string)
+		if !ok {
+			return fmt.Errorf("path must be a string")
+		}
+		if req.Path, err = validateIngressPath(p); err != nil {
+			return err
+		}
+	}
+
+	if raw, ok := args["ingress_annotations"]; ok && raw != nil {
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("ingress_annotations must be an object")
+		}
+		req.IngressAnnotations = make(map[string]string, len(obj))
+		for k, v := range obj {
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("ingress_annotations[%q] must be a string", k)
+			}
+			req.IngressAnnotations[k] = s
+		}
+		if err := d.validateIngressAnnotations(req.IngressAnnotations); err != nil {
+			return err
+		}
+	}
+
+	if req.Exposure == exposureNone && (req.Aliases != nil || req.Path != "" || req.IngressAnnotations != nil) {
+		return fmt.Errorf("hosts, path and ingress_annotations need an Ingress, which exposure=%s does not render", exposureNone)
+	}
+	return nil
+}
+
+// validateAliases checks the additional hostnames of appName and returns
+// them lower-cased, sorted and without duplicates. An alias may be any fully
+// qualified name, including an apex domain, but not the app's own host.
+func (d *Deployer) validateAliases(appName string, aliases []string) ([]string, error) {
+	result := make([]string, 0, len(aliases))
+	for _, alias := range aliases {
+		alias = strings.TrimSuffix(strings.ToLower(alias), ".")
+		if msgs := validation.IsDNS1123Subdomain(alias); len(msgs) > 0 {
+			return nil, fmt.Errorf("host %q is invalid: %s", alias, strings.Join(msgs, "; "))
+		}
+		if !strings.Contains(alias, ".") {
+			return nil, fmt.Errorf("host %q must be a fully qualified domain name", alias)
+		}
+		if alias == d.appHost(appName) {
+			return nil, fmt.Errorf("host %q is the app's own host and must not be listed in hosts", alias)
+		}
+		if secret := aliasTLSSecretName(appName, alias); len(secret) > validation.DNS1123SubdomainMaxLength {
+			return nil, fmt.Errorf("host %q is too long: its TLS secret name %s would exceed %d characters", alias, secret, validation.DNS1123SubdomainMaxLength)
+		}
+		if !slices.Contains(result, alias) {
+			result = append(result, alias)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+// aliasTLSSecretName is the name templates/ingress.yaml gives the TLS secret
+// of an alias.
+func aliasTLSSecretName(appName, alias string) string {
+	return appName + "-" + strings.ReplaceAll(alias, ".", "-") + "-tls"
+}
+
+// validateIngressPath checks a path prefix routed to an app and returns it
+// without a trailing slash.
+func validateIngressPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("path %q must start with /", p)
+	}
+	if p == "/" {
+		return p, nil
+	}
+	for _, seg := range strings.Split(strings.TrimSuffix(p[1:], "/"), "/") {
+		if !ingressPathSegment.MatchString(seg) || seg == "." || seg == ".." {
+			return "", fmt.Errorf("path %q is invalid: segments must be non-empty and consist of letters, digits, '.', '_', '~' or '-'", p)
+		}
+	}
+	return strings.TrimSuffix(p, "/"), nil
+}
+
+// validateIngressAnnotations checks the keys of per-app Ingress annotations.
+func (d *Deployer) validateIngressAnnotations(annotations map[string]string) error {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if msgs := validation.IsQualifiedName(k); len(msgs) > 0 {
+			return fmt.Errorf("ingress_annotations key %q is invalid: %s", k, strings.Join(msgs, "; "))
+		}
+		if d.reservedAnnotation(k) {
+			return fmt.Errorf("ingress_annotations key %q is set by the deployer itself", k)
+		}
+	}
+	return nil
+}
+
+func (d *Deployer) reservedAnnotation(key string) bool {
+	if key == d.cfg.AllowlistAnnotation {
+		return true
+	}
+	for _, prefix := range reservedAnnotationPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readIngressOptions fills in the aliases, path, annotations and
+// authentication method of an image app from its rendered Ingress.
+func (d *Deployer) readIngressOptions(a *existingApp, raw []byte, primaryHost string) {
+	var ingress networkingv1.Ingress
+	if yaml.Unmarshal(raw, &ingress) != nil {
+		return
+	}
+	a.TLS = len(ingress.Spec.TLS) > 0
+	for _, rule := range ingress.Spec.Rules {
+		if rule.Host != primaryHost && !slices.Contains(a.Aliases, rule.Host) {
+			a.Aliases = append(a.Aliases, rule.Host)
+		}
+		if a.Path == "" && rule.HTTP != nil && len(rule.HTTP.Paths) > 0 {
+			a.Path = rule.HTTP.Paths[0].Path
+		}
+	}
+	for k, v := range ingress.Annotations {
+		if auth := authFromAnnotation(k, v); auth != "" {
+			a.Auth = auth
+		}
+		if d.reservedAnnotation(k) {
+			continue
+		}
+		if a.IngressAnnotations == nil {
+			a.IngressAnnotations = map[string]string{}
+		}
+		a.IngressAnnotations[k] = v
+	}
+}
+
+// readHelmIngressOptions fills in the TLS state, Ingress annotations,
+// allowed CIDRs and authentication method of a Helm app from the parameters
+// of its ArgoCD Application.
+func (d *Deployer) readHelmIngressOptions(a *existingApp, app *unstructured.Unstructured) {
+	params, _, _ := unstructured.NestedSlice(app.Object, "spec", "source", "helm", "parameters")
+	for _, p := range params {
+		param, _ := p.(map[string]interface{})
+		name, _ := param["name"].(string)
+		value, _ := param["value"].(string)
+		switch {
+		case name == "ingress.tls":
+			a.TLS = value == "true"
+		case strings.HasPrefix(name, helmAnnotationParam):
+			key := strings.ReplaceAll(strings.TrimPrefix(name, helmAnnotationParam), `\.`, ".")
+			if key == d.cfg.AllowlistAnnotation {
+				a.AllowedCIDRs = strings.Split(value, ",")
+			}
+			if auth := authFromAnnotation(key, value); auth != "" {
+				a.Auth = auth
+			}
+			if d.reservedAnnotation(key) {
+				continue
+			}
+			if a.IngressAnnotations == nil {
+				a.IngressAnnotations = map[string]string{}
+			}
+			a.IngressAnnotations[key] = value
+		}
+	}
+}
+
+// helmAnnotationParams returns the Helm parameters setting annotations on
+// a Helm app's Ingress, sorted by key.
+func helmAnnotationParams(annotations map[string]string) []HelmParameter {
+	params := make([]HelmParameter, 0, len(annotations))
+	for k, v := range annotations {
+		params = append(params, HelmParameter{Name: helmAnnotationParam + strings.ReplaceAll(k, ".", `\.`), Value: v})
+	}
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return params
+}
+
+// probePath is the path status appends to the app's host to check that its
+// Ingress is reachable: the app's path prefix, if it has one.
+func (a *existingApp) probePath() string {
+	if a == nil || a.Path == "/" {
+		return ""
+	}
+	return a.Path
+}
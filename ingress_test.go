@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIngressOptions(t *testing.T) {
+	h := newHarness(t)
+	h.d.cfg.IngressClass = "nginx"
+
+	h.call("deploy-image", map[string]interface{}{
+		"app_name":            "web",
+		"image":               "nginx:1.27",
+		"hosts":               []interface{}{"WWW.Example.org", "example.org."},
+		"ingress_annotations": map[string]interface{}{"nginx.ingress.kubernetes.io/proxy-body-size": "50m"},
+	}, false)
+	ingress := readRepoFile(t, h.d, "manifests/web/ingress.yaml")
+	for _, want := range []string{"ingressClassName: nginx", "- host: web.example.com", "- host: www.example.org", "- host: example.org", `nginx.ingress.kubernetes.io/proxy-body-size: "50m"`, "path: /\n"} {
+		if !strings.Contains(ingress, want) {
+			t.Errorf("ingress lacks %q:\n%s", want, ingress)
+		}
+	}
+
+	// Another app may be routed a path on the same host, but not the same
+	// host and path.
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.27", "hosts": []interface{}{"www.example.org"}, "path": "/api/"}, false)
+	if ingress := readRepoFile(t, h.d, "manifests/api/ingress.yaml"); !strings.Contains(ingress, "path: /api\n") {
+		t.Fatalf("api ingress lacks its path:\n%s", ingress)
+	}
+	out := h.call("deploy-image", map[string]interface{}{"app_name": "shop", "image": "nginx:1.27", "hosts": []interface{}{"example.org"}}, true)
+	if !strings.Contains(out, "example.org is already routed to app web") {
+		t.Fatalf("unexpected collision error: %s", out)
+	}
+	out = h.call("deploy-image", map[string]interface{}{"app_name": "web2", "image": "nginx:1.27", "hosts": []interface{}{"api.example.com"}, "path": "/api"}, true)
+	if !strings.Contains(out, "api.example.com/api is already routed to app api") {
+		t.Fatalf("unexpected collision error: %s", out)
+	}
+
+	// Upgrades keep the Ingress options unless new ones are given.
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.28", "mode": modeUpgrade}, false)
+	ingress = readRepoFile(t, h.d, "manifests/web/ingress.yaml")
+	if !strings.Contains(ingress, "- host: example.org") || !strings.Contains(ingress, "proxy-body-size") {
+		t.Fatalf("upgrade dropped the ingress options:\n%s", ingress)
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.28", "mode": modeUpgrade, "hosts": []interface{}{}}, false)
+	if ingress := readRepoFile(t, h.d, "manifests/web/ingress.yaml"); strings.Contains(ingress, "example.org") {
+		t.Fatalf("upgrade kept removed hosts:\n%s", ingress)
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "shop", "image": "nginx:1.27", "hosts": []interface{}{"example.org"}}, false)
+
+	h.call("deploy-helmchart", map[string]interface{}{
+		"app_name":            "chart",
+		"chart":               "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0",
+		"ingress_annotations": map[string]interface{}{"nginx.ingress.kubernetes.io/proxy-read-timeout": "300"},
+	}, false)
+	app := readRepoFile(t, h.d, "argocd-apps/chart.yaml")
+	for _, want := range []string{`value: "nginx"`, `"ingress.annotations.nginx\\.ingress\\.kubernetes\\.io/proxy-read-timeout"`} {
+		if !strings.Contains(app, want) {
+			t.Errorf("helm application lacks %q:\n%s", want, app)
+		}
+	}
+
+	for _, test := range []struct {
+		tool    string
+		args    map[string]interface{}
+		wantErr string
+	}{
+		{"deploy-image", map[string]interface{}{"hosts": []interface{}{"localhost"}}, "fully qualified"},
+		{"deploy-image", map[string]interface{}{"hosts": []interface{}{"bad.example.com"}}, "the app's own host"},
+		{"deploy-image", map[string]interface{}{"hosts": []interface{}{strings.Repeat(strings.Repeat("a", 60)+".", 4) + "com"}}, "TLS secret name"},
+		{"deploy-image", map[string]interface{}{"path": "api"}, "must start with /"},
+		{"deploy-image", map[string]interface{}{"path": "/a/../b"}, "is invalid"},
+		{"deploy-image", map[string]interface{}{"ingress_annotations": map[string]interface{}{"mcp-app-deployer/owner": "eve"}}, "set by the deployer"},
+		{"deploy-image", map[string]interface{}{"exposure": exposureNone, "path": "/x"}, "need an Ingress"},
+		{"deploy-helmchart", map[string]interface{}{"path": "/x"}, "not supported for Helm charts"},
+	} {
+		args := map[string]interface{}{"app_name": "bad", "image": "nginx:1.27", "chart": "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0"}
+		for k, v := range test.args {
+			args[k] = v
+		}
+		if out := h.call(test.tool, args, true); !strings.Contains(out, test.wantErr) {
+			t.Errorf("%s %v: got %q, want it to contain %q", test.tool, test.args, out, test.wantErr)
+		}
+	}
+}
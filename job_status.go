@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recentJobs is how many of an app's most recent Jobs status reports.
+const recentJobs = 5
+
+// jobStatus reports on the CronJob (sourceCronJob) or Job (sourceJob) of an
+// app: its schedule and last runs, and the outcome of its most recent Jobs.
+func (d *Deployer) jobStatus(ctx context.Context, appName, namespace, source string) []string {
+	var result []string
+	if source == sourceCronJob {
+		cj, err := d.kube.BatchV1().CronJobs(namespace).Get(ctx, appName, metav1.GetOptions{})
+		if err != nil {
+			return []string{fmt.Sprintf("❌ CronJob not found in namespace %s: %v", namespace, err)}
+		}
+		line := fmt.Sprintf("✅ CronJob schedule %q", cj.Spec.Schedule)
+		if cj.Spec.Suspend != nil && *cj.Spec.Suspend {
+			line = fmt.Sprintf("⚠️ CronJob schedule %q is suspended", cj.Spec.Schedule)
+		}
+		result = append(result, line,
+			"Last scheduled: "+formatJobTime(cj.Status.LastScheduleTime),
+			"Last successful run: "+formatJobTime(cj.Status.LastSuccessfulTime),
+		)
+	}
+
+	jobs, err := d.kube.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{LabelSelector: "app=" + appName})
+	if err != nil {
+		return append(result, fmt.Sprintf("Error listing jobs: %v", err))
+	}
+	if len(jobs.Items) == 0 {
+		if source == sourceJob {
+			return append(result, fmt.Sprintf("⏳ Job not created yet in namespace %s", namespace))
+		}
+		return append(result, "No jobs have run yet")
+	}
+
+	items := jobs.Items
+	sort.Slice(items, func(i, j int) bool {
+		return items[j].CreationTimestamp.Before(&items[i].CreationTimestamp)
+	})
+	if len(items) > recentJobs {
+		items = items[:recentJobs]
+	}
+	result = append(result, "Recent jobs:")
+	for _, job := range items {
+		result = append(result, "  "+jobOutcome(&job))
+	}
+	return result
+}
+
+// jobOutcome describes whether job succeeded, failed or is still running.
+func jobOutcome(job *batchv1.Job) string {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return fmt.Sprintf("✅ %s succeeded at %s", job.Name, formatJobTime(job.Status.CompletionTime))
+		case batchv1.JobFailed:
+			reason := c.Reason
+			if c.Message != "" {
+				reason += ": " + c.Message
+			}
+			return fmt.Sprintf("❌ %s failed at %s (%s)", job.Name, c.LastTransitionTime.UTC().Format(time.RFC3339), reason)
+		}
+	}
+	if job.Status.StartTime == nil {
+		return fmt.Sprintf("⏳ %s pending", job.Name)
+	}
+	return fmt.Sprintf("⏳ %s running since %s (%d active, %d failed attempts)", job.Name, formatJobTime(job.Status.StartTime), job.Status.Active, job.Status.Failed)
+}
+
+func formatJobTime(t *metav1.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
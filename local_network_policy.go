@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// localNetworkPolicyAppName is the ArgoCD Application that owns the
+// NetworkPolicy restricting the local namespace.
+const localNetworkPolicyAppName = "local-namespace-network-policy"
+
+// localNetworkPolicyName is the NetworkPolicy rendered from
+// templates/networkpolicy.yaml.
+const localNetworkPolicyName = "allow-local-subnets"
+
+// errLocalSubnetsUnset is returned by reconcileLocalNetworkPolicy when apps
+// are deployed in the local namespace but no subnets are configured.
+var errLocalSubnetsUnset = errors.New("--local-allowed-subnets must be set to deploy applications with exposure=local")
+
+// localApps returns the apps deployed in the local namespace in files,
+// sorted by name.
+func (d *Deployer) localApps(files repoFiles) ([]string, error) {
+	names, err := files.listDir(d.cfg.ArgoCDAppPath)
+	if err != nil {
+		return nil, err
+	}
+	var apps []string
+	for _, name := range names {
+		appName, ok := strings.CutSuffix(name, ".yaml")
+		if !ok || reservedAppNames[appName] {
+			continue
+		}
+		existing, err := d.readExistingApp(files, appName)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.Namespace == d.cfg.LocalNamespace {
+			apps = append(apps, appName)
+		}
+	}
+	slices.Sort(apps)
+	return apps, nil
+}
+
+// reconcileLocalNetworkPolicy brings the bootstrap app restricting the local
+// namespace in ws in line with the configuration: it is rendered with the
+// current --local-allowed-subnets while any app is deployed in the local
+// namespace, and removed once none is. Without subnets an existing policy is
+// left alone rather than opening the namespace, and errLocalSubnetsUnset is
+// returned. Rewriting unchanged files produces no git diff.
+func (d *Deployer) reconcileLocalNetworkPolicy(ws *workspace) error {
+	apps, err := d.localApps(ws)
+	if err != nil {
+		return fmt.Errorf("list local apps: %w", err)
+	}
+	npDir := path.Join(d.cfg.ManifestPath, localNetworkPolicyAppName)
+	if len(apps) == 0 {
+		if err := ws.removeAll(npDir); err != nil {
+			return err
+		}
+		return ws.removeAll(d.argoAppFile(localNetworkPolicyAppName))
+	}
+
+	subnets := []string(d.cfg.LocalAllowedSubnets)
+	if len(subnets) == 0 {
+		return errLocalSubnetsUnset
+	}
+
+	npData := struct {
+		Namespace      string
+		AllowedSubnets []string
+	}{Namespace: d.cfg.LocalNamespace, AllowedSubnets: subnets}
+
+	m, err := renderManifest(d.templates, "templates/networkpolicy.yaml", npData)
+	if err != nil {
+		return fmt.Errorf("render networkpolicy template: %w", err)
+	}
+
+	if err := ws.writeFile(path.Join(npDir, "networkpolicy.yaml"), m.Content); err != nil {
+		return err
+	}
+
+	argoData := ArgoApplicationData{
+		Name:      localNetworkPolicyAppName,
+		Namespace: d.cfg.LocalNamespace,
+		Git: &ArgoGitSource{
+			RepoURL:        d.repo.URL(),
+			TargetRevision: "HEAD",
+			Path:           npDir,
+		},
+	}
+
+	app, err := d.renderArgoApplication("templates/application.yaml", argoData)
+	if err != nil {
+		return err
+	}
+	return ws.writeFile(app.path, app.Content)
+}
+
+// syncLocalNetworkPolicy commits whatever reconcileLocalNetworkPolicy
+// changes at HEAD. The server calls it on start, so that a changed
+// --local-allowed-subnets takes effect without waiting for a deploy.
+func (d *Deployer) syncLocalNetworkPolicy(ctx context.Context) error {
+	ws, err := d.checkout(ctx)
+	if err != nil {
+		return err
+	}
+	defer ws.close()
+
+	if err := d.reconcileLocalNetworkPolicy(ws); err != nil {
+		return err
+	}
+	if err := d.commitAndPush(ctx, ws, "Reconcile local namespace network policy"); err != nil && err != errNoChanges {
+		return err
+	}
+	return nil
+}
+
+// localNetworkPolicy reports the subnets the local namespace admits in Git
+// and in the cluster, against those configured, and the apps it covers.
+func (d *Deployer) localNetworkPolicy(ctx context.Context) (*mcp.CallToolResult, error) {
+	tree, err := d.repo.HeadTree(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read repository: %v", err)), nil
+	}
+	files := treeFiles{tree}
+	apps, err := d.localApps(files)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to list local apps: %v", err)), nil
+	}
+
+	configured := []string(d.cfg.LocalAllowedSubnets)
+	result := []string{
+		fmt.Sprintf("Local namespace network policy (namespace %s)", d.cfg.LocalNamespace),
+		"Configured subnets: " + listOrNone(configured),
+	}
+	if len(apps) == 0 {
+		result = append(result, "Local apps: none")
+	} else {
+		result = append(result, "Local apps: "+strings.Join(apps, ", "))
+	}
+
+	var inGit []string
+	raw, err := files.readFile(path.Join(d.cfg.ManifestPath, localNetworkPolicyAppName, "networkpolicy.yaml"))
+	switch {
+	case err != nil && len(apps) == 0:
+		result = append(result, "✅ Not in Git, as no app is deployed in the local namespace")
+	case err != nil:
+		result = append(result, "❌ Not in Git although apps are deployed in the local namespace; the next deploy, destroy or server start renders it")
+	default:
+		inGit = networkPolicyCIDRs(raw)
+		result = append(result, "Subnets in Git: "+listOrNone(inGit))
+		switch {
+		case len(apps) == 0:
+			result = append(result, "⚠️ No app is deployed in the local namespace any more; the next deploy, destroy or server start removes the policy")
+		case !sameSubnets(inGit, configured):
+			result = append(result, "⚠️ Git differs from --local-allowed-subnets; the next deploy, destroy or server start updates it")
+		default:
+			result = append(result, "✅ Git matches --local-allowed-subnets")
+		}
+	}
+
+	np, err := d.kube.NetworkingV1().NetworkPolicies(d.cfg.LocalNamespace).Get(ctx, localNetworkPolicyName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		result = append(result, fmt.Sprintf("Cluster: NetworkPolicy %s not found", localNetworkPolicyName))
+	case err != nil:
+		result = append(result, fmt.Sprintf("❌ Cluster: %v", err))
+	default:
+		inCluster := ipBlockCIDRs(np)
+		line := "Subnets in the cluster: " + listOrNone(inCluster)
+		if inGit != nil && !sameSubnets(inCluster, inGit) {
+			line = "⏳ " + line + " (ArgoCD has not synced Git yet)"
+		}
+		result = append(result, line)
+	}
+	return mcp.NewToolResultText(strings.Join(result, "\n")), nil
+}
+
+func listOrNone(list []string) string {
+	if len(list) == 0 {
+		return "none"
+	}
+	return strings.Join(list, ", ")
+}
+
+// sameSubnets reports whether a and b hold the same subnets in any order.
+func sameSubnets(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLocalNetworkPolicyReconciliation(t *testing.T) {
+	h := newHarness(t)
+	const npFile = "manifests/local-namespace-network-policy/networkpolicy.yaml"
+	appFile := "argocd-apps/" + localNetworkPolicyAppName + ".yaml"
+
+	if out := h.call("local-network-policy", map[string]interface{}{}, false); !strings.Contains(out, "✅ Not in Git, as no app is deployed in the local namespace") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "nas", "image": "nginx:1.27", "exposure": exposureLocal}, false)
+	h.call("deploy-image", map[string]interface{}{"app_name": "printer", "image": "nginx:1.27", "exposure": exposureLocal}, false)
+	if np := readRepoFile(t, h.d, npFile); !strings.Contains(np, "cidr: 192.168.0.0/16") {
+		t.Fatalf("bootstrap policy not rendered:\n%s", np)
+	}
+
+	// A changed configuration shows as drift until the server restarts.
+	h.d.cfg.LocalAllowedSubnets = stringList{"10.0.0.0/8"}
+	out := h.call("local-network-policy", map[string]interface{}{}, false)
+	for _, want := range []string{"Local apps: nas, printer", "Subnets in Git: 192.168.0.0/16", "Configured subnets: 10.0.0.0/8", "⚠️ Git differs"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if err := h.d.syncLocalNetworkPolicy(context.Background()); err != nil {
+		t.Fatalf("syncLocalNetworkPolicy: %v", err)
+	}
+	if np := readRepoFile(t, h.d, npFile); !strings.Contains(np, "cidr: 10.0.0.0/8") || strings.Contains(np, "192.168.0.0/16") {
+		t.Fatalf("restart did not update the subnets:\n%s", np)
+	}
+
+	// The cluster lags behind Git until ArgoCD syncs.
+	h.d.kube.NetworkingV1().NetworkPolicies(h.d.cfg.LocalNamespace).Create(context.Background(), &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: localNetworkPolicyName, Namespace: h.d.cfg.LocalNamespace},
+		Spec: networkingv1.NetworkPolicySpec{Ingress: []networkingv1.NetworkPolicyIngressRule{{
+			From: []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "192.168.0.0/16"}}},
+		}}},
+	}, metav1.CreateOptions{})
+	if out := h.call("local-network-policy", map[string]interface{}{}, false); !strings.Contains(out, "⏳ Subnets in the cluster: 192.168.0.0/16 (ArgoCD has not synced Git yet)") {
+		t.Fatalf("cluster state not reported:\n%s", out)
+	}
+
+	// Any deploy or destroy also reconciles.
+	h.d.cfg.LocalAllowedSubnets = stringList{"10.0.0.0/8", "172.16.0.0/12"}
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.27"}, false)
+	if np := readRepoFile(t, h.d, npFile); !strings.Contains(np, "cidr: 172.16.0.0/12") {
+		t.Fatalf("public deploy did not update the subnets:\n%s", np)
+	}
+
+	// Without subnets, deploys to other namespaces keep the policy.
+	h.d.cfg.LocalAllowedSubnets = nil
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.28", "mode": modeUpgrade}, false)
+	if np := readRepoFile(t, h.d, npFile); !strings.Contains(np, "cidr: 172.16.0.0/12") {
+		t.Fatalf("policy changed without subnets:\n%s", np)
+	}
+	h.d.cfg.LocalAllowedSubnets = stringList{"10.0.0.0/8"}
+
+	for _, app := range []string{"nas", "printer"} {
+		plan := h.call("destroy", map[string]interface{}{"app_name": app}, false)
+		if app == "printer" && !strings.Contains(plan, appFile) {
+			t.Errorf("destroying the last local app does not plan to remove the policy:\n%s", plan)
+		}
+		h.call("destroy", map[string]interface{}{"app_name": app, "confirm_token": confirmToken(t, plan)}, false)
+		if got := readRepoFile(t, h.d, appFile); (got == "") != (app == "printer") {
+			t.Fatalf("after destroying %s, bootstrap app present = %v", app, got != "")
+		}
+	}
+	if np := readRepoFile(t, h.d, npFile); np != "" {
+		t.Fatalf("policy kept without local apps:\n%s", np)
+	}
+}
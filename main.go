@@ -2,42 +2,39 @@ package main
 
 import (
 	"context"
-	"crypto/subtle"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-)
-
-var (
-	kubeconfigPath      string
-	namespace           string
-	localNamespace      string
-	localAllowedSubnets string
-	domain              string
-	githubURL           string
-	githubToken         string
-	argocdAppPath       string
-	manifestPath        string
-	httpAddr            string
-	httpPassword        string
-	httpEndpointPath    string
+	batchv1 "k8s.io/api/batch/v1"
 )
 
 const (
 	exposurePublic = "public"
 	exposureLocal  = "local"
+	// exposureNone deploys into the public namespace without an Ingress, so
+	// the app is only reachable from inside the cluster.
+	exposureNone = "none"
+	// exposureAuthenticated deploys into the public namespace behind single
+	// sign-on or basic auth, enforced by the ingress controller.
+	exposureAuthenticated = "authenticated"
 )
 
-func resolveExposure(args map[string]interface{}) (string, string, error) {
+func (d *Deployer) resolveExposure(args map[string]interface{}) (string, string, error) {
 	raw, ok := args["exposure"]
 	if !ok || raw == nil {
-		return exposurePublic, namespace, nil
+		return exposurePublic, d.cfg.Namespace, nil
 	}
 	str, ok := raw.(string)
 	if !ok {
@@ -45,55 +42,133 @@ func resolveExposure(args map[string]interface{}) (string, string, error) {
 	}
 	switch str {
 	case "", exposurePublic:
-		return exposurePublic, namespace, nil
+		return exposurePublic, d.cfg.Namespace, nil
 	case exposureLocal:
-		return exposureLocal, localNamespace, nil
+		return exposureLocal, d.cfg.LocalNamespace, nil
+	case exposureNone:
+		return exposureNone, d.cfg.Namespace, nil
+	case exposureAuthenticated:
+		return exposureAuthenticated, d.cfg.Namespace, nil
 	default:
-		return "", "", fmt.Errorf("exposure must be %q or %q", exposurePublic, exposureLocal)
+		return "", "", fmt.Errorf("exposure must be %q, %q, %q or %q", exposurePublic, exposureLocal, exposureAuthenticated, exposureNone)
 	}
 }
 
-func allowedSubnets() []string {
-	if strings.TrimSpace(localAllowedSubnets) == "" {
-		return nil
+// deployRequestArgs extracts the arguments shared by the deploy tools.
+func (d *Deployer) deployRequestArgs(args map[string]interface{}) (deployRequest, error) {
+	var req deployRequest
+	var err error
+	if req.AppName, err = d.appNameArg(args); err != nil {
+		return req, err
 	}
-	parts := strings.Split(localAllowedSubnets, ",")
-	out := make([]string, 0, len(parts))
-	for _, p := range parts {
-		if s := strings.TrimSpace(p); s != "" {
-			out = append(out, s)
-		}
+	if req.Exposure, req.Namespace, err = d.resolveExposure(args); err != nil {
+		return req, err
+	}
+	req.ExposureGiven = args["exposure"] != nil
+	switch mode := args["mode"]; mode {
+	case nil, "", modeCreate:
+		req.Mode = modeCreate
+	case modeUpgrade, modeReplace:
+		req.Mode = mode.(string)
+	default:
+		return req, fmt.Errorf("mode must be %q, %q or %q", modeCreate, modeUpgrade, modeReplace)
+	}
+	if req.Protected, err = optionalBoolArg(args, "protected"); err != nil {
+		return req, err
+	}
+	if req.DryRun, err = boolArg(args, "dry_run"); err != nil {
+		return req, err
 	}
-	return out
+	if req.TLS, err = optionalBoolArg(args, "tls"); err != nil {
+		return req, err
+	}
+	return req, nil
 }
 
 func main() {
-	// Parse command line flags
-	flag.StringVar(&kubeconfigPath, "kubeconfig", "", "Path to kubeconfig file")
-	flag.StringVar(&namespace, "namespace", "applications", "Kubernetes namespace for public applications")
-	flag.StringVar(&localNamespace, "local-namespace", "applications-local", "Kubernetes namespace for local applications")
-	flag.StringVar(&localAllowedSubnets, "local-allowed-subnets", "", "Comma-separated list of CIDR subnets permitted to reach local applications")
-	flag.StringVar(&domain, "domain", "tykus.net", "Base domain for ingress")
-	flag.StringVar(&githubURL, "github-url", "", "GitHub URL (e.g., https://github.com/user/repo)")
-	flag.StringVar(&githubToken, "github-token", "", "GitHub Personal Access Token")
-	flag.StringVar(&argocdAppPath, "argocd-path", "argocd-apps", "Path in repo for ArgoCD apps")
-	flag.StringVar(&manifestPath, "manifest-path", "manifests", "Path in repo for Kubernetes manifests")
-	flag.StringVar(&httpAddr, "http", "", "If set (e.g. \":8080\"), serve MCP over Streamable HTTP on this address instead of stdio")
-	flag.StringVar(&httpPassword, "http-password", "", "Bearer token required to access the HTTP endpoint (required when --http is set; falls back to MCP_HTTP_PASSWORD env var)")
-	flag.StringVar(&httpEndpointPath, "http-path", "/mcp", "URL path for the MCP HTTP endpoint")
-	flag.Parse()
-
-	if httpAddr != "" && httpPassword == "" {
-		httpPassword = os.Getenv("MCP_HTTP_PASSWORD")
-	}
-
-	// Validate required flags
-	if kubeconfigPath == "" || githubURL == "" || githubToken == "" {
-		fmt.Println("Error: --kubeconfig, --github-url, and --github-token are required")
-		flag.Usage()
+	// Merge flags, MCP_DEPLOYER_* environment variables and the config file
+	cfg, err := loadConfig(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	d, err := newDeployerFromConfig(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
+	// Bring the local namespace's NetworkPolicy in line with the current
+	// configuration; deploys and destroys retry if Git is unavailable now.
+	if err := d.syncLocalNetworkPolicy(context.Background()); errors.Is(err, errLocalSubnetsUnset) {
+		log.Printf("Apps are deployed in the local namespace but --local-allowed-subnets is not set; keeping its network policy as it is in Git")
+	} else if err != nil {
+		log.Printf("Failed to reconcile local namespace network policy: %v", err)
+	}
+
+	s := newMCPServer(d)
+
+	if cfg.HTTPAddr != "" {
+		users, err := loadHTTPUsers(cfg.HTTPUsersFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		httpServer := server.NewStreamableHTTPServer(s,
+			server.WithEndpointPath(cfg.HTTPEndpointPath),
+		)
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		// Restore the default handling once the first signal arrives, so
+		// that a second one still kills the process during the grace period.
+		context.AfterFunc(ctx, stop)
+
+		mux := http.NewServeMux()
+		mux.Handle(cfg.HTTPEndpointPath, authMiddleware(cfg.HTTPPassword, users, endStreamsOnShutdown(ctx, httpServer)))
+		srv := &http.Server{Addr: cfg.HTTPAddr, Handler: mux}
+		log.Printf("MCP HTTP server listening on %s%s", cfg.HTTPAddr, cfg.HTTPEndpointPath)
+		if err := serveUntilSignal(ctx, srv, cfg.ShutdownGracePeriod); err != nil {
+			log.Printf("Server error: %v\n", err)
+		}
+		return
+	}
+
+	// Start server on stdio
+	if err := server.ServeStdio(s); err != nil {
+		log.Printf("Server error: %v\n", err)
+	}
+}
+
+// authMiddleware requires a bearer token matching the shared password or one
+// of users, and attaches the matching identity to the request context.
+func authMiddleware(password string, users []httpUser, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var provided string
+		if h := r.Header.Get("Authorization"); h != "" {
+			if strings.HasPrefix(h, "Bearer ") {
+				provided = strings.TrimPrefix(h, "Bearer ")
+			}
+		}
+		if provided == "" {
+			provided = r.Header.Get("X-MCP-Password")
+		}
+		c, ok := authenticate(provided, password, users)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withCaller(r.Context(), c)))
+	})
+}
+
+// newMCPServer creates the MCP server and registers every tool backed by d.
+func newMCPServer(d *Deployer) *server.MCPServer {
 	// Create MCP server
 	s := server.NewMCPServer(
 		"mcp-app-deployer",
@@ -101,165 +176,452 @@ func main() {
 		server.WithLogging(),
 	)
 
+	allowedCIDRsArg := mcp.WithArray("allowed_cidrs", mcp.WithStringItems(), mcp.Description("Source networks allowed to reach the app, e.g. [\"203.0.113.0/24\"], instead of its namespace's default. Image apps get a NetworkPolicy on their pods; with --allowlist-annotation the Ingress is restricted too. On mode=upgrade, omit to keep the current ones, or pass [] to remove them"))
+	authArg := mcp.WithString("auth", mcp.Enum(authSSO, authBasic), mcp.Description("How visitors of an app with exposure=authenticated log in: \"sso\" through the server's oauth2-proxy (the default when the server has --auth-url), or \"basic\" with a generated password, returned once by this call. On mode=upgrade, omit to keep the current one"))
+	egressArg := mcp.WithAny("egress", mcp.Description("Restrict where the app's pods may connect to, besides cluster DNS: an object with any of \"cidrs\" (e.g. [\"10.0.0.0/8\"]), \"namespaces\" (e.g. [\"databases\"]) and \"ports\" (e.g. [443, \"5432/TCP\"]), or \"unrestricted\" to remove the restriction. Omitted, new apps are unrestricted and mode=upgrade keeps the current setting"))
+	ingressAnnotationsArg := mcp.WithObject("ingress_annotations", mcp.Description("Extra annotations for the app's Ingress, e.g. {\"nginx.ingress.kubernetes.io/proxy-body-size\": \"50m\"}. On mode=upgrade, omit to keep the current ones"))
+
 	// Register tools
 	s.AddTool(mcp.NewTool("deploy-image",
 		mcp.WithDescription("Deploy a new application from a container image"),
 		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
 		mcp.WithString("image", mcp.Required(), mcp.Description("Container image to deploy")),
-		mcp.WithString("exposure", mcp.Description("Exposure mode: \"public\" (default) exposes the app to the public internet; \"local\" restricts it to configured local subnets")),
-	), deployHandler)
+		mcp.WithString("exposure", mcp.Description("Exposure mode: \"public\" (default, or \"none\" for the worker profile) exposes the app to the public internet; \"local\" restricts it to configured local subnets; \"authenticated\" exposes it behind single sign-on or basic auth (see auth); \"none\" renders no Ingress, leaving the app reachable only inside the cluster")),
+		mcp.WithString("profile", mcp.Enum(profileNames(d.profiles)...), mcp.Description("Shape of the app, selecting the manifests to render (default \""+defaultProfile+"\"; on mode=upgrade, omit to keep the current one):"+describeProfiles(d.profiles))),
+		mcp.WithObject("parameters", mcp.Description("Parameters for the profile, matching its parameters schema; on mode=upgrade, omit to keep the current ones")),
+		mcp.WithString("mode", mcp.Enum(modeCreate, modeUpgrade, modeReplace), mcp.Description("What to do if the app already exists: \"create\" (default) refuses; \"upgrade\" changes its image or chart but not its source type or exposure; \"replace\" removes the existing app and deploys this one in the same commit")),
+		mcp.WithBoolean("protected", mcp.Description("Mark the app as protected so that only admins can change or destroy it; omit to keep the current setting")),
+		mcp.WithBoolean("tls", mcp.Description("Serve the app over HTTPS with a certificate from the server's cert-manager issuer; defaults to true when the server has --tls-issuer. On mode=upgrade, omit to keep the current setting")),
+		mcp.WithArray("hosts", mcp.WithStringItems(), mcp.Description("Additional hostnames served besides <app_name>.<domain>, e.g. [\"www.example.org\", \"example.org\"]; their DNS must point at the cluster. On mode=upgrade, omit to keep the current ones")),
+		mcp.WithString("path", mcp.Description("Path prefix routed to the app on each of its hosts (default \"/\"), e.g. \"/api\" to serve the app under another app's host listed in hosts. On mode=upgrade, omit to keep the current one")),
+		ingressAnnotationsArg,
+		allowedCIDRsArg,
+		authArg,
+		egressArg,
+		mcp.WithBoolean("dry_run", mcp.Description("If true, return the Git diff this call would commit without committing or pushing it")),
+	), d.deployHandler)
 
 	s.AddTool(mcp.NewTool("deploy-helmchart",
 		mcp.WithDescription("Deploy a new application from an OCI Helm chart"),
 		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
 		mcp.WithString("chart", mcp.Required(), mcp.Description("Full OCI Helm chart reference including version, for example oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0")),
-		mcp.WithString("exposure", mcp.Description("Exposure mode: \"public\" (default) exposes the app to the public internet; \"local\" restricts it to configured local subnets")),
-	), deployHelmChartHandler)
+		mcp.WithString("exposure", mcp.Description("Exposure mode: \"public\" (default) exposes the app to the public internet; \"local\" restricts it to configured local subnets; \"authenticated\" exposes it behind the server's oauth2-proxy single sign-on")),
+		mcp.WithString("mode", mcp.Enum(modeCreate, modeUpgrade, modeReplace), mcp.Description("What to do if the app already exists: \"create\" (default) refuses; \"upgrade\" changes its image or chart but not its source type or exposure; \"replace\" removes the existing app and deploys this one in the same commit")),
+		mcp.WithBoolean("protected", mcp.Description("Mark the app as protected so that only admins can change or destroy it; omit to keep the current setting")),
+		mcp.WithBoolean("tls", mcp.Description("Serve the app over HTTPS with a certificate from the server's cert-manager issuer; defaults to true when the server has --tls-issuer. On mode=upgrade, omit to keep the current setting")),
+		ingressAnnotationsArg,
+		allowedCIDRsArg,
+		authArg,
+		mcp.WithBoolean("dry_run", mcp.Description("If true, return the Git diff this call would commit without committing or pushing it")),
+	), d.deployHelmChartHandler)
+
+	s.AddTool(mcp.NewTool("deploy-cronjob",
+		mcp.WithDescription("Deploy a scheduled task as a Kubernetes CronJob in the public namespace, without a Service or Ingress"),
+		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
+		mcp.WithString("image", mcp.Required(), mcp.Description("Container image to run")),
+		mcp.WithString("schedule", mcp.Required(), mcp.Description("Cron schedule with five fields, e.g. \"0 3 * * *\", or a macro such as \"@daily\"; evaluated in the cluster's time zone")),
+		mcp.WithArray("command", mcp.WithStringItems(), mcp.Description("Command and arguments overriding the image entrypoint, e.g. [\"/bin/backup\", \"--all\"]")),
+		mcp.WithString("concurrency_policy", mcp.Enum(concurrencyPolicies...), mcp.Description("What to do when a run is due while the previous one is still running (default \"Allow\")")),
+		mcp.WithNumber("successful_jobs_history_limit", mcp.Min(0), mcp.Max(100), mcp.Description("Finished successful Jobs to keep (default 3)")),
+		mcp.WithNumber("failed_jobs_history_limit", mcp.Min(0), mcp.Max(100), mcp.Description("Failed Jobs to keep (default 1)")),
+		mcp.WithString("mode", mcp.Enum(modeCreate, modeUpgrade, modeReplace), mcp.Description("What to do if the app already exists: \"create\" (default) refuses; \"upgrade\" changes it; \"replace\" removes the existing app and deploys this one in the same commit")),
+		mcp.WithBoolean("protected", mcp.Description("Mark the app as protected so that only admins can change or destroy it; omit to keep the current setting")),
+		egressArg,
+		mcp.WithBoolean("dry_run", mcp.Description("If true, return the Git diff this call would commit without committing or pushing it")),
+	), d.deployCronJobHandler)
+
+	s.AddTool(mcp.NewTool("run-job",
+		mcp.WithDescription("Run a one-off task, such as a migration, as a Kubernetes Job in the public namespace. Call again with mode=upgrade to run it again"),
+		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
+		mcp.WithString("image", mcp.Required(), mcp.Description("Container image to run")),
+		mcp.WithArray("command", mcp.WithStringItems(), mcp.Description("Command and arguments overriding the image entrypoint, e.g. [\"/bin/migrate\", \"up\"]")),
+		mcp.WithNumber("backoff_limit", mcp.Min(0), mcp.Max(100), mcp.Description("Retries before the Job is marked failed (default 6)")),
+		mcp.WithString("mode", mcp.Enum(modeCreate, modeUpgrade, modeReplace), mcp.Description("What to do if the app already exists: \"create\" (default) refuses; \"upgrade\" runs the Job again, with the new image and command; \"replace\" removes the existing app and runs this one in the same commit")),
+		mcp.WithBoolean("protected", mcp.Description("Mark the app as protected so that only admins can change or destroy it; omit to keep the current setting")),
+		egressArg,
+		mcp.WithBoolean("dry_run", mcp.Description("If true, return the Git diff this call would commit without committing or pushing it")),
+	), d.runJobHandler)
 
 	s.AddTool(mcp.NewTool("destroy",
-		mcp.WithDescription("Destroy an existing application"),
+		mcp.WithDescription("Destroy an existing application. The first call only returns a plan and a confirm_token; call again with the token to delete the app"),
+		mcp.WithDestructiveHintAnnotation(true),
 		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
-	), destroyHandler)
+		mcp.WithString("confirm_token", mcp.Description("Token returned by a previous destroy call for the same app, confirming the deletion")),
+		mcp.WithBoolean("dry_run", mcp.Description("If true, return the Git diff this call would commit without committing or pushing it")),
+	), d.destroyHandler)
 
 	s.AddTool(mcp.NewTool("status",
 		mcp.WithDescription("Get status of an application"),
 		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
-	), statusHandler)
+	), d.statusHandler)
+
+	s.AddTool(mcp.NewTool("hosts",
+		mcp.WithDescription("List every ingress host and path in the GitOps repository with the app it is routed to"),
+	), d.hostsHandler)
+
+	s.AddTool(mcp.NewTool("local-network-policy",
+		mcp.WithDescription("Show the subnets the NetworkPolicy of the local namespace admits, in Git and in the cluster, against the server's --local-allowed-subnets, and the apps deployed there"),
+	), d.localNetworkPolicyHandler)
+
+	s.AddTool(mcp.NewTool("set-exposure",
+		mcp.WithDescription("Move an existing app between the public namespace and the local namespace in a single commit, keeping its manifests, and wait for ArgoCD to prune it from the old namespace. Switching between public, authenticated and none exposure is done by redeploying with mode=upgrade"),
+		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
+		mcp.WithString("exposure", mcp.Required(), mcp.Enum(exposurePublic, exposureLocal), mcp.Description("\"public\" moves the app to the public namespace; \"local\" moves it to the local namespace, restricted to configured local subnets")),
+		mcp.WithBoolean("dry_run", mcp.Description("If true, return the Git diff this call would commit without committing or pushing it")),
+	), d.setExposureHandler)
 
 	s.AddTool(mcp.NewTool("update",
 		mcp.WithDescription("Trigger a rolling restart of an application's deployment"),
 		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
-	), updateHandler)
+	), d.updateHandler)
 
-	if httpAddr != "" {
-		if httpPassword == "" {
-			fmt.Println("Error: --http-password (or MCP_HTTP_PASSWORD) is required when --http is set")
-			os.Exit(1)
-		}
-		httpServer := server.NewStreamableHTTPServer(s,
-			server.WithEndpointPath(httpEndpointPath),
-		)
-		mux := http.NewServeMux()
-		mux.Handle(httpEndpointPath, authMiddleware(httpPassword, httpServer))
-		srv := &http.Server{Addr: httpAddr, Handler: mux}
-		log.Printf("MCP HTTP server listening on %s%s", httpAddr, httpEndpointPath)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Server error: %v\n", err)
+	s.AddTool(mcp.NewTool("check-policy",
+		mcp.WithDescription("Dry-run the deployment policy against an image or Helm chart deployment without changing Git"),
+		mcp.WithString("app_name", mcp.Required(), mcp.Description("Name of the application")),
+		mcp.WithString("image", mcp.Description("Container image to check (set exactly one of image and chart)")),
+		mcp.WithString("chart", mcp.Description("Full OCI Helm chart reference to check (set exactly one of image and chart)")),
+		mcp.WithString("exposure", mcp.Description("Exposure mode: \"public\" (default), \"local\", \"authenticated\" or \"none\"")),
+	), d.checkPolicyHandler)
+
+	return s
+}
+
+// serveUntilSignal runs srv on srv.Addr until it fails or ctx is cancelled by
+// a shutdown signal. On shutdown the listener is closed immediately so no new
+// requests are accepted, and in-flight requests (tool calls that may be half
+// way through a commit and push) get up to gracePeriod to complete before the
+// remaining connections are forcibly closed.
+func serveUntilSignal(ctx context.Context, srv *http.Server, gracePeriod time.Duration) error {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	return serveListenerUntilSignal(ctx, srv, ln, gracePeriod)
+}
+
+// serveListenerUntilSignal is serveUntilSignal on an existing listener.
+func serveListenerUntilSignal(ctx context.Context, srv *http.Server, ln net.Listener, gracePeriod time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errCh:
+		if err == http.ErrServerClosed {
+			return nil
 		}
-		return
+		return err
+	case <-ctx.Done():
 	}
 
-	// Start server on stdio
-	if err := server.ServeStdio(s); err != nil {
-		log.Printf("Server error: %v\n", err)
+	log.Printf("Shutdown signal received, waiting up to %s for in-flight requests", gracePeriod)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Grace period expired, closing remaining connections: %v", err)
+		return srv.Close()
 	}
+	log.Printf("All in-flight requests completed, server stopped")
+	return nil
 }
 
-func authMiddleware(password string, next http.Handler) http.Handler {
-	expected := []byte(password)
+// endStreamsOnShutdown cancels long-lived GET (server-sent events) streams
+// once ctx is done. Those streams never become idle on their own and would
+// otherwise hold http.Server.Shutdown open for the whole grace period, while
+// POST requests carrying tool calls are left to run to completion.
+func endStreamsOnShutdown(ctx context.Context, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var provided string
-		if h := r.Header.Get("Authorization"); h != "" {
-			if strings.HasPrefix(h, "Bearer ") {
-				provided = strings.TrimPrefix(h, "Bearer ")
-			}
-		}
-		if provided == "" {
-			provided = r.Header.Get("X-MCP-Password")
-		}
-		if subtle.ConstantTimeCompare([]byte(provided), expected) != 1 {
-			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp"`)
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
 			return
 		}
-		next.ServeHTTP(w, r)
+		streamCtx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		stopAfter := context.AfterFunc(ctx, cancel)
+		defer stopAfter()
+		next.ServeHTTP(w, r.WithContext(streamCtx))
 	})
 }
 
-func deployHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (d *Deployer) deployHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
 		return mcp.NewToolResultError("arguments must be a map"), nil
 	}
 
-	appName, ok := args["app_name"].(string)
-	if !ok {
-		return mcp.NewToolResultError("app_name must be a string"), nil
+	req, err := d.deployRequestArgs(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 	image, ok := args["image"].(string)
 	if !ok {
 		return mcp.NewToolResultError("image must be a string"), nil
 	}
-
-	exposure, targetNamespace, err := resolveExposure(args)
+	if req.Profile, ok = args["profile"].(string); !ok && args["profile"] != nil {
+		return mcp.NewToolResultError("profile must be a string"), nil
+	}
+	if req.Parameters, ok = args["parameters"].(map[string]interface{}); !ok && args["parameters"] != nil {
+		return mcp.NewToolResultError("parameters must be an object"), nil
+	}
+	if req.Profile == workerProfile && args["exposure"] == nil {
+		req.Exposure = exposureNone
+	}
+	if err := d.ingressRequestArgs(args, &req); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if req.AllowedCIDRs, err = allowedCIDRsArg(args); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if req.Egress, err = egressArg(args); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	imageRef, err := parseImageReference(image)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
+	if err := d.policy.checkImage(imageRef); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	return deploy(ctx, appName, image, exposure, targetNamespace)
+	return d.deploy(ctx, req, image)
 }
 
-func deployHelmChartHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (d *Deployer) deployHelmChartHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
 		return mcp.NewToolResultError("arguments must be a map"), nil
 	}
 
-	appName, ok := args["app_name"].(string)
-	if !ok {
-		return mcp.NewToolResultError("app_name must be a string"), nil
+	req, err := d.deployRequestArgs(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 	chartRef, ok := args["chart"].(string)
 	if !ok {
 		return mcp.NewToolResultError("chart must be a string"), nil
 	}
+	if req.Exposure == exposureNone {
+		return mcp.NewToolResultError(fmt.Sprintf("exposure=%s is not supported for Helm charts; configure the chart's ingress instead", exposureNone)), nil
+	}
+	if args["hosts"] != nil || args["path"] != nil {
+		return mcp.NewToolResultError("hosts and path are not supported for Helm charts; configure the chart's ingress instead"), nil
+	}
+	if args["egress"] != nil {
+		return mcp.NewToolResultError("egress is not supported for Helm charts, whose pod labels are not known; configure the chart's network policy instead"), nil
+	}
+	if err := d.ingressRequestArgs(args, &req); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if req.AllowedCIDRs, err = allowedCIDRsArg(args); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	chartSource, err := parseOCIHelmChartRef(chartRef)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid OCI chart reference: %v", err)), nil
+	}
+	if err := d.policy.checkChart(chartSource); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
 
-	exposure, targetNamespace, err := resolveExposure(args)
+	return d.deployHelmChart(ctx, req, chartRef)
+}
+
+// jobIngressArgs are the deploy-image arguments about serving an app, which
+// the job tools refuse.
+var jobIngressArgs = []string{"exposure", "tls", "hosts", "path", "ingress_annotations", "allowed_cidrs", "auth"}
+
+// jobRequestArgs extracts the arguments shared by deploy-cronjob and
+// run-job. Jobs have no Ingress and always run in the public namespace.
+func (d *Deployer) jobRequestArgs(args map[string]interface{}) (deployRequest, string, jobSpec, error) {
+	var spec jobSpec
+	for _, name := range jobIngressArgs {
+		if args[name] != nil {
+			return deployRequest{}, "", spec, fmt.Errorf("%s is not supported for CronJobs and Jobs, which have no Service or Ingress and always run in namespace %s", name, d.cfg.Namespace)
+		}
+	}
+	req, err := d.deployRequestArgs(args)
 	if err != nil {
+		return req, "", spec, err
+	}
+	req.Exposure, req.Namespace = exposureNone, d.cfg.Namespace
+
+	image, ok := args["image"].(string)
+	if !ok {
+		return req, "", spec, fmt.Errorf("image must be a string")
+	}
+	imageRef, err := parseImageReference(image)
+	if err != nil {
+		return req, "", spec, err
+	}
+	if err := d.policy.checkImage(imageRef); err != nil {
+		return req, "", spec, err
+	}
+	if spec.Command, err = stringListArg(args, "command"); err != nil {
+		return req, "", spec, err
+	}
+	if req.Egress, err = egressArg(args); err != nil {
+		return req, "", spec, err
+	}
+	return req, image, spec, nil
+}
+
+func (d *Deployer) deployCronJobHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
+	if !ok {
+		return mcp.NewToolResultError("arguments must be a map"), nil
+	}
+
+	req, image, spec, err := d.jobRequestArgs(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if spec.Schedule, ok = args["schedule"].(string); !ok {
+		return mcp.NewToolResultError("schedule must be a string"), nil
+	}
+	switch policy := args["concurrency_policy"]; policy {
+	case nil, "":
+		spec.ConcurrencyPolicy = string(batchv1.AllowConcurrent)
+	default:
+		if spec.ConcurrencyPolicy, ok = policy.(string); !ok || !slices.Contains(concurrencyPolicies, spec.ConcurrencyPolicy) {
+			return mcp.NewToolResultError(fmt.Sprintf("concurrency_policy must be one of %s", strings.Join(concurrencyPolicies, ", "))), nil
+		}
+	}
+	if spec.SuccessfulJobsHistoryLimit, err = intArg(args, "successful_jobs_history_limit", 3, 0, 100); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if spec.FailedJobsHistoryLimit, err = intArg(args, "failed_jobs_history_limit", 1, 0, 100); err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	return deployHelmChart(ctx, appName, chartRef, exposure, targetNamespace)
+	return d.deployCronJob(ctx, req, image, spec)
 }
 
-func destroyHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (d *Deployer) runJobHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
 		return mcp.NewToolResultError("arguments must be a map"), nil
 	}
 
-	appName, ok := args["app_name"].(string)
+	req, image, spec, err := d.jobRequestArgs(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if spec.BackoffLimit, err = intArg(args, "backoff_limit", 6, 0, 100); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return d.runJob(ctx, req, image, spec)
+}
+
+func (d *Deployer) destroyHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
-		return mcp.NewToolResultError("app_name must be a string"), nil
+		return mcp.NewToolResultError("arguments must be a map"), nil
 	}
 
-	return destroy(ctx, appName)
+	appName, err := d.appNameArg(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	dryRun, err := boolArg(args, "dry_run")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	confirmToken, ok := args["confirm_token"].(string)
+	if !ok && args["confirm_token"] != nil {
+		return mcp.NewToolResultError("confirm_token must be a string"), nil
+	}
+
+	return d.destroy(ctx, appName, confirmToken, dryRun)
 }
 
-func statusHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (d *Deployer) statusHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
 		return mcp.NewToolResultError("arguments must be a map"), nil
 	}
 
-	appName, ok := args["app_name"].(string)
+	appName, err := d.appNameArg(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return d.status(ctx, appName)
+}
+
+func (d *Deployer) hostsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return d.hosts(ctx)
+}
+
+func (d *Deployer) localNetworkPolicyHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return d.localNetworkPolicy(ctx)
+}
+
+func (d *Deployer) setExposureHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
-		return mcp.NewToolResultError("app_name must be a string"), nil
+		return mcp.NewToolResultError("arguments must be a map"), nil
+	}
+
+	appName, err := d.appNameArg(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	return status(ctx, appName)
+	exposure, namespace, err := d.resolveExposure(args)
+	if err == nil && (args["exposure"] == nil || (exposure != exposurePublic && exposure != exposureLocal)) {
+		err = fmt.Errorf("exposure must be %q or %q", exposurePublic, exposureLocal)
+	}
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	dryRun, err := boolArg(args, "dry_run")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return d.setExposure(ctx, appName, exposure, namespace, dryRun)
 }
 
-func updateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (d *Deployer) updateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
 		return mcp.NewToolResultError("arguments must be a map"), nil
 	}
 
-	appName, ok := args["app_name"].(string)
+	appName, err := d.appNameArg(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	return d.update(ctx, appName)
+}
+
+func (d *Deployer) checkPolicyHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args, ok := request.Params.Arguments.(map[string]interface{})
 	if !ok {
-		return mcp.NewToolResultError("app_name must be a string"), nil
+		return mcp.NewToolResultError("arguments must be a map"), nil
+	}
+
+	appName, err := d.appNameArg(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	image, _ := args["image"].(string)
+	chartRef, _ := args["chart"].(string)
+	if (image == "") == (chartRef == "") {
+		return mcp.NewToolResultError("exactly one of image and chart must be set"), nil
+	}
+
+	exposure, targetNamespace, err := d.resolveExposure(args)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
 	}
 
-	return update(ctx, appName)
+	return d.checkPolicy(ctx, appName, image, chartRef, exposure, targetNamespace)
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsToolCallsAndEndsStreams(t *testing.T) {
+	callStarted, releaseCall := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// A server-sent events stream, open until the client leaves.
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		close(callStarted)
+		<-releaseCall
+		io.WriteString(w, "tool call done")
+	})
+
+	ctx, sendSignal := context.WithCancel(context.Background())
+	defer sendSignal()
+	ts := httptest.NewUnstartedServer(endStreamsOnShutdown(ctx, mux))
+	url := "http://" + ts.Listener.Addr().String() + "/mcp"
+	const gracePeriod = 5 * time.Second
+	served := make(chan error, 1)
+	go func() {
+		served <- serveListenerUntilSignal(ctx, ts.Config, ts.Listener, gracePeriod)
+	}()
+
+	stream, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer stream.Body.Close()
+	streamEnded := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, stream.Body)
+		close(streamEnded)
+	}()
+
+	type response struct {
+		body string
+		err  error
+	}
+	call := make(chan response, 1)
+	go func() {
+		res, err := http.Post(url, "application/json", strings.NewReader("{}"))
+		if err != nil {
+			call <- response{err: err}
+			return
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		call <- response{string(body), err}
+	}()
+	<-callStarted
+
+	sendSignal()
+	shutdownStarted := time.Now()
+	select {
+	case <-streamEnded:
+	case <-time.After(time.Second):
+		t.Fatal("GET stream still open after shutdown started")
+	}
+
+	select {
+	case err := <-served:
+		t.Fatalf("server stopped with a tool call in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(releaseCall)
+	if res := <-call; res.err != nil || res.body != "tool call done" {
+		t.Fatalf("in-flight tool call = %q, %v", res.body, res.err)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serveListenerUntilSignal returned error: %v", err)
+		}
+	case <-time.After(gracePeriod):
+		t.Fatal("shutdown did not finish within the grace period")
+	}
+	if elapsed := time.Since(shutdownStarted); elapsed >= gracePeriod {
+		t.Fatalf("shutdown took %s, want less than the %s grace period", elapsed, gracePeriod)
+	}
+}
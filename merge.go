@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// generatedDir keeps, per app, a copy of every file exactly as the tool last
+// rendered it. It lives outside the manifest and ArgoCD paths, so ArgoCD never
+// applies it; it is the common ancestor when merging manual edits.
+const generatedDir = ".mcp-app-deployer/generated"
+
+// generatedCopy is the repository path of the last generated copy of rel.
+func generatedCopy(appName, rel string) string {
+	return path.Join(generatedDir, appName, rel)
+}
+
+// writeGenerated writes freshly rendered files for appName, keeping any
+// manual edits made to them in Git since the tool last wrote them. It is a
+// three-way merge between the last generated copy, the newly rendered file and
+// the file currently in Git: whatever changed between the two renderings is
+// applied to the file in Git, and everything else a human added or changed is
+// kept. Where a human and the tool changed the same field, the tool wins.
+// Files generated for appName before that are no longer rendered, such as the
+// Ingress of an app redeployed with exposure=none, are removed.
+//
+// It returns the files as written, manual edits included, for the policy
+// rules to check before they are committed.
+func (ws *workspace) writeGenerated(appName string, files []renderedFile) ([]renderedFile, error) {
+	written := make([]renderedFile, 0, len(files))
+	for _, f := range files {
+		merged := f
+
+		current, err := ws.readFile(f.path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err == nil && !bytes.Equal(current, f.Content) {
+			original, err := ws.readFile(generatedCopy(appName, f.path))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			if !bytes.Equal(current, original) {
+				content, err := mergeManifest(original, f.Content, current, f)
+				if err != nil {
+					return nil, fmt.Errorf("merge manual edits into %s: %w; redeploy with mode=%s to discard them", f.path, err, modeReplace)
+				}
+				objects, err := decodeManifest(content)
+				if err != nil {
+					return nil, fmt.Errorf("merged manifest %s is invalid: %w", f.path, err)
+				}
+				merged = renderedFile{path: f.path, manifest: &manifest{Content: content, Objects: objects}}
+			}
+		}
+
+		if err := ws.writeFile(f.path, merged.Content); err != nil {
+			return nil, err
+		}
+		if err := ws.writeFile(generatedCopy(appName, f.path), f.Content); err != nil {
+			return nil, err
+		}
+		written = append(written, merged)
+	}
+	if err := ws.removeStale(appName, files); err != nil {
+		return nil, err
+	}
+	return written, nil
+}
+
+// removeStale removes the files that have a generated copy for appName but
+// are not among files, together with their generated copies.
+func (ws *workspace) removeStale(appName string, files []renderedFile) error {
+	root, err := ws.abs(path.Join(generatedDir, appName))
+	if err != nil {
+		return err
+	}
+	rendered := make(map[string]bool, len(files))
+	for _, f := range files {
+		rendered[f.path] = true
+	}
+
+	var stale []string
+	err = filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == root {
+			return fs.SkipAll
+		}
+		if err != nil || e.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); !rendered[rel] {
+			stale = append(stale, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range stale {
+		if err := ws.removeAll(rel); err != nil {
+			return err
+		}
+		if err := ws.removeAll(generatedCopy(appName, rel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeManifest applies the changes between original and modified to
+// current. Kinds with a client-go type use a strategic merge, which merges
+// lists such as containers and env by name; anything else uses a JSON merge
+// patch. The result is validated like any rendered manifest.
+//
+// A nil original means the app was deployed before generated copies were
+// kept. The merge then behaves like kubectl apply without a last-applied
+// configuration: every field the tool renders is set and extra fields in
+// current are kept.
+func mergeManifest(original, modified, current []byte, f renderedFile) ([]byte, error) {
+	if len(f.Objects) != 1 {
+		return nil, errors.New("only single-document manifests can be merged")
+	}
+
+	modified, err := singleDocumentJSON(modified)
+	if err != nil {
+		return nil, err
+	}
+	if current, err = singleDocumentJSON(current); err != nil {
+		return nil, err
+	}
+	if original != nil {
+		if original, err = singleDocumentJSON(original); err != nil {
+			return nil, err
+		}
+	}
+
+	var merged []byte
+	if _, ok := f.Objects[0].(*unstructured.Unstructured); ok {
+		var patch []byte
+		if original == nil {
+			patch, err = jsonmergepatch.CreateThreeWayJSONMergePatch(modified, modified, current)
+		} else {
+			patch, err = jsonpatch.CreateMergePatch(original, modified)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if merged, err = jsonpatch.MergePatch(current, patch); err != nil {
+			return nil, err
+		}
+	} else {
+		var patch []byte
+		if original == nil {
+			schema, serr := strategicpatch.NewPatchMetaFromStruct(f.Objects[0])
+			if serr != nil {
+				return nil, serr
+			}
+			patch, err = strategicpatch.CreateThreeWayMergePatch(modified, modified, current, schema, true)
+		} else {
+			patch, err = strategicpatch.CreateTwoWayMergePatch(original, modified, f.Objects[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		if merged, err = strategicpatch.StrategicMergePatch(current, patch, f.Objects[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := yaml.JSONToYAML(merged)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decodeManifest(content); err != nil {
+		return nil, fmt.Errorf("merged manifest is invalid: %w", err)
+	}
+	return content, nil
+}
+
+// singleDocumentJSON converts a YAML file holding exactly one document to
+// JSON.
+func singleDocumentJSON(content []byte) ([]byte, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	var doc []byte
+	for {
+		next, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(next)) == 0 {
+			continue
+		}
+		if doc != nil {
+			return nil, errors.New("only single-document manifests can be merged")
+		}
+		doc = next
+	}
+	if doc == nil {
+		return nil, errors.New("manifest is empty")
+	}
+	return yaml.YAMLToJSON(doc)
+}
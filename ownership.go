@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Annotations recording who deployed an app and whether it is protected.
+// They are rendered onto the ArgoCD Application and every manifest.
+const (
+	ownerAnnotation     = "mcp-app-deployer/owner"
+	protectedAnnotation = "mcp-app-deployer/protected"
+)
+
+// Ownership is the owner and protection state of an app. The zero value is
+// an app deployed before ownership was recorded, which anyone may change.
+type Ownership struct {
+	Owner     string
+	Protected bool
+}
+
+func ownershipFromAnnotations(annotations map[string]string) Ownership {
+	return Ownership{
+		Owner:     annotations[ownerAnnotation],
+		Protected: annotations[protectedAnnotation] == "true",
+	}
+}
+
+// authorize refuses changes to protected apps and to apps owned by someone
+// else, unless c is an admin.
+func (o Ownership) authorize(c caller, appName string) error {
+	switch {
+	case c.Admin:
+		return nil
+	case o.Protected:
+		return fmt.Errorf("app %s is protected; only an admin can change or destroy it", appName)
+	case o.Owner != "" && o.Owner != c.Name:
+		return fmt.Errorf("app %s is owned by %s; only the owner or an admin can change or destroy it", appName, o.Owner)
+	}
+	return nil
+}
+
+// claim returns the ownership to render when c (re)deploys an app currently
+// owned as o. An existing owner is kept; protected overrides the current
+// protection state when set.
+func (o Ownership) claim(c caller, protected *bool) Ownership {
+	if o.Owner == "" {
+		o.Owner = c.Name
+	}
+	if protected != nil {
+		o.Protected = *protected
+	}
+	return o
+}
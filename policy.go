@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Policy restricts what callers may deploy. It is loaded from the YAML file
+// given by --policy-file; without one every image and chart is allowed.
+type Policy struct {
+	Images ImagePolicy    `yaml:"images"`
+	Charts RegistryPolicy `yaml:"charts"`
+	Rules  []PolicyRule   `yaml:"rules"`
+}
+
+// ImagePolicy restricts the images accepted by deploy-image.
+type ImagePolicy struct {
+	RegistryPolicy `yaml:",inline"`
+	// ForbidLatest rejects images tagged :latest, including untagged
+	// images that implicitly resolve to it. Digest-pinned images pass.
+	ForbidLatest bool `yaml:"forbid-latest"`
+}
+
+// RegistryPolicy is an allowlist of registries and repositories. An empty
+// list allows everything.
+type RegistryPolicy struct {
+	Allow []RegistryRule `yaml:"allow"`
+}
+
+// RegistryRule matches references by registry host and repository path.
+// Both are path.Match globs; a repository ending in "/**" also matches any
+// number of nested path segments. An empty repository matches any.
+type RegistryRule struct {
+	Registry   string `yaml:"registry"`
+	Repository string `yaml:"repository"`
+}
+
+func (r RegistryRule) String() string {
+	repo := r.Repository
+	if repo == "" {
+		repo = "**"
+	}
+	return r.Registry + "/" + repo
+}
+
+func (r RegistryRule) matches(registry, repository string) bool {
+	if ok, _ := path.Match(r.Registry, registry); !ok {
+		return false
+	}
+	if r.Repository == "" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(r.Repository, "/**"); ok {
+		parts := strings.Split(repository, "/")
+		for i := 1; i <= len(parts); i++ {
+			if m, _ := path.Match(prefix, strings.Join(parts[:i], "/")); m {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(r.Repository, repository)
+	return ok
+}
+
+// PolicyViolation is returned when a request is blocked by a policy rule.
+type PolicyViolation struct {
+	// Rule identifies the rule in the policy file, e.g. "images.allow".
+	Rule   string
+	Reason string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("policy violation (%s): %s", v.Rule, v.Reason)
+}
+
+// loadPolicy reads a policy file. An empty path returns nil, which allows
+// everything.
+func loadPolicy(file string) (*Policy, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("read policy file: %w", err)
+	}
+	defer f.Close()
+
+	p := &Policy{}
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("parse policy file %s: %w", file, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("policy file %s: %w", file, err)
+	}
+	return p, nil
+}
+
+func (p *Policy) validate() error {
+	sections := []struct {
+		name  string
+		rules []RegistryRule
+	}{
+		{"images.allow", p.Images.Allow},
+		{"charts.allow", p.Charts.Allow},
+	}
+	for _, section := range sections {
+		for i, r := range section.rules {
+			if r.Registry == "" {
+				return fmt.Errorf("%s[%d]: registry is required", section.name, i)
+			}
+			for _, pattern := range []string{r.Registry, strings.TrimSuffix(r.Repository, "/**")} {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return fmt.Errorf("%s[%d]: invalid pattern %q: %w", section.name, i, pattern, err)
+				}
+			}
+		}
+	}
+	names := make(map[string]bool, len(p.Rules))
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if err := r.compile(); err != nil {
+			return fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("rules[%d]: duplicate rule name %q", i, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+// checkImage enforces the image policy on a parsed image reference.
+func (p *Policy) checkImage(ref *imageReference) error {
+	if p == nil {
+		return nil
+	}
+	if err := p.Images.check("images.allow", "image", ref.Registry, ref.Repository); err != nil {
+		return err
+	}
+	if p.Images.ForbidLatest && ref.Digest == "" && (ref.Tag == "" || ref.Tag == "latest") {
+		return &PolicyViolation{
+			Rule:   "images.forbid-latest",
+			Reason: fmt.Sprintf("image %s must be pinned to a tag other than latest or to a digest", ref),
+		}
+	}
+	return nil
+}
+
+// checkChart enforces the chart registry policy on a parsed chart reference.
+func (p *Policy) checkChart(chart *ArgoHelmSource) error {
+	if p == nil {
+		return nil
+	}
+	registry, repository, _ := strings.Cut(chart.RepoURL, "/")
+	return p.Charts.check("charts.allow", "chart", registry, path.Join(repository, chart.Chart))
+}
+
+func (rp RegistryPolicy) check(rule, what, registry, repository string) error {
+	if len(rp.Allow) == 0 {
+		return nil
+	}
+	allowed := make([]string, 0, len(rp.Allow))
+	for _, r := range rp.Allow {
+		if r.matches(registry, repository) {
+			return nil
+		}
+		allowed = append(allowed, r.String())
+	}
+	return &PolicyViolation{
+		Rule:   rule,
+		Reason: fmt.Sprintf("%s %s/%s does not match any allowed registry/repository (allowed: %s)", what, registry, repository, strings.Join(allowed, ", ")),
+	}
+}
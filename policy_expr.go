@@ -0,0 +1,670 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// This file implements the small CEL-like expression language used by policy
+// rules. An expression is evaluated against variables holding plain
+// JSON-like values (maps, slices, strings, numbers, booleans and nil) and
+// must produce a boolean.
+//
+//	literals     "str" 'str' 42 1.5 true false null [a, b]
+//	access       object.spec.replicas  list[0]  map["key"]
+//	operators    ! && || == != < <= > >= in
+//	functions    has(x) size(x) startsWith(s, p) endsWith(s, p)
+//	             contains(s, sub) matches(s, re) quantity(s)
+//	macros       all(list, v, expr) any(list, v, expr)
+//
+// Accessing a missing field yields null rather than an error, so
+// has(object.spec.template.spec.hostNetwork) and
+// object.spec.template.spec.hostNetwork == true are both safe on any object.
+
+// expr is a compiled expression.
+type expr interface {
+	eval(env map[string]interface{}) (interface{}, error)
+}
+
+// compileExpr parses src into an expression.
+func compileExpr(src string) (expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+	}
+	return e, nil
+}
+
+// evalBool evaluates e and requires a boolean result.
+func evalBool(e expr, env map[string]interface{}) (bool, error) {
+	v, err := e.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %T, want bool", v)
+	}
+	return b, nil
+}
+
+// --- lexer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var twoCharOps = []string{"==", "!=", "<=", ">=", "&&", "||"}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, src[start:i], start})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, src[start:i], start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for ; i < len(src) && rune(src[i]) != c; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, token{tokString, sb.String(), start})
+		default:
+			op := string(c)
+			for _, two := range twoCharOps {
+				if strings.HasPrefix(src[i:], two) {
+					op = two
+				}
+			}
+			if !strings.Contains("!<>()[].,", op) && len(op) == 1 {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokEOF, "end of expression", len(src)}), nil
+}
+
+// --- parser ---
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		tok := p.peek()
+		return fmt.Errorf("expected %q at offset %d, got %q", op, tok.pos, tok.text)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	isCmp := tok.kind == tokOp && strings.Contains(" == != < <= > >= ", " "+tok.text+" ")
+	if !isCmp && !(tok.kind == tokIdent && tok.text == "in") {
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &compareExpr{op: tok.text, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (expr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("."):
+			tok := p.next()
+			if tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected field name at offset %d, got %q", tok.pos, tok.text)
+			}
+			e = &indexExpr{target: e, index: &literalExpr{tok.text}}
+		case p.accept("["):
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			e = &indexExpr{target: e, index: index}
+		default:
+			return e, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		if n, err := strconv.ParseInt(tok.text, 10, 64); err == nil {
+			return &literalExpr{n}, nil
+		}
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at offset %d", tok.text, tok.pos)
+		}
+		return &literalExpr{f}, nil
+	case tokString:
+		return &literalExpr{tok.text}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalExpr{true}, nil
+		case "false":
+			return &literalExpr{false}, nil
+		case "null":
+			return &literalExpr{nil}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(tok)
+		}
+		return &varExpr{tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			e, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		case "[":
+			list := &listExpr{}
+			for !p.accept("]") {
+				if len(list.items) > 0 {
+					if err := p.expect(","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at offset %d", tok.text, tok.pos)
+}
+
+func (p *exprParser) parseCall(name token) (expr, error) {
+	var args []expr
+	for !p.accept(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	if name.text == "all" || name.text == "any" {
+		var v *varExpr
+		if len(args) == 3 {
+			v, _ = args[1].(*varExpr)
+		}
+		if v == nil {
+			return nil, fmt.Errorf("%s at offset %d: want %s(list, variable, predicate)", name.text, name.pos, name.text)
+		}
+		return &quantifierExpr{all: name.text == "all", list: args[0], variable: v.name, pred: args[2]}, nil
+	}
+
+	fn, ok := exprFuncs[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+	}
+	if len(args) != fn.arity {
+		return nil, fmt.Errorf("%s at offset %d: want %d arguments, got %d", name.text, name.pos, fn.arity, len(args))
+	}
+	// A literal pattern is checked now, so that a broken rule is rejected
+	// when the policy is loaded rather than on every deploy.
+	if lit, ok := args[len(args)-1].(*literalExpr); ok && name.text == "matches" {
+		if pattern, ok := lit.value.(string); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("matches at offset %d: invalid pattern %q: %v", name.pos, pattern, err)
+			}
+		}
+	}
+	return &callExpr{name: name.text, fn: fn.call, args: args}, nil
+}
+
+// --- evaluation ---
+
+type literalExpr struct{ value interface{} }
+
+func (e *literalExpr) eval(map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+type varExpr struct{ name string }
+
+func (e *varExpr) eval(env map[string]interface{}) (interface{}, error) {
+	v, ok := env[e.name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %q", e.name)
+	}
+	return v, nil
+}
+
+type listExpr struct{ items []expr }
+
+func (e *listExpr) eval(env map[string]interface{}) (interface{}, error) {
+	out := make([]interface{}, 0, len(e.items))
+	for _, item := range e.items {
+		v, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+type indexExpr struct {
+	target expr
+	index  expr
+}
+
+func (e *indexExpr) eval(env map[string]interface{}) (interface{}, error) {
+	target, err := e.target.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	index, err := e.index.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch t := target.(type) {
+	case map[string]interface{}:
+		key, ok := index.(string)
+		if !ok {
+			return nil, fmt.Errorf("map index must be a string, got %T", index)
+		}
+		return t[key], nil
+	case []interface{}:
+		i, ok := index.(int64)
+		if !ok {
+			return nil, fmt.Errorf("list index must be an integer, got %T", index)
+		}
+		if i < 0 || int(i) >= len(t) {
+			return nil, nil
+		}
+		return t[i], nil
+	}
+	return nil, nil
+}
+
+type notExpr struct{ operand expr }
+
+func (e *notExpr) eval(env map[string]interface{}) (interface{}, error) {
+	b, err := evalBool(e.operand, env)
+	return !b, err
+}
+
+type logicalExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *logicalExpr) eval(env map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(e.left, env)
+	if err != nil {
+		return nil, err
+	}
+	if (e.op == "&&" && !left) || (e.op == "||" && left) {
+		return left, nil
+	}
+	return evalBool(e.right, env)
+}
+
+type compareExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *compareExpr) eval(env map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.op {
+	case "==":
+		return valuesEqual(left, right), nil
+	case "!=":
+		return !valuesEqual(left, right), nil
+	case "in":
+		switch r := right.(type) {
+		case []interface{}:
+			for _, item := range r {
+				if valuesEqual(left, item) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			key, ok := left.(string)
+			_, found := r[key]
+			return ok && found, nil
+		}
+		return nil, fmt.Errorf("right side of 'in' must be a list or map, got %T", right)
+	}
+
+	c, err := compareValues(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		return ok && fa == fb
+	}
+	if qa, ok := a.(resource.Quantity); ok {
+		qb, ok := b.(resource.Quantity)
+		return ok && qa.Cmp(qb) == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compareValues(a, b interface{}) (int, error) {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1, nil
+			case fa > fb:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			return strings.Compare(sa, sb), nil
+		}
+	}
+	if qa, ok := a.(resource.Quantity); ok {
+		if qb, ok := b.(resource.Quantity); ok {
+			return qa.Cmp(qb), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %s with %s", describeValue(a), describeValue(b))
+}
+
+func describeValue(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+type quantifierExpr struct {
+	all      bool
+	list     expr
+	variable string
+	pred     expr
+}
+
+func (e *quantifierExpr) eval(env map[string]interface{}) (interface{}, error) {
+	v, err := e.list.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return e.all, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("all/any need a list, got %T", v)
+	}
+
+	scope := make(map[string]interface{}, len(env)+1)
+	for k, val := range env {
+		scope[k] = val
+	}
+	for _, item := range list {
+		scope[e.variable] = item
+		ok, err := evalBool(e.pred, scope)
+		if err != nil {
+			return nil, err
+		}
+		if ok != e.all {
+			return ok, nil
+		}
+	}
+	return e.all, nil
+}
+
+type callExpr struct {
+	name string
+	fn   func(args []interface{}) (interface{}, error)
+	args []expr
+}
+
+func (e *callExpr) eval(env map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, a := range e.args {
+		v, err := a.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := e.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.name, err)
+	}
+	return v, nil
+}
+
+var exprFuncs = map[string]struct {
+	arity int
+	call  func(args []interface{}) (interface{}, error)
+}{
+	"has": {1, func(args []interface{}) (interface{}, error) {
+		return args[0] != nil, nil
+	}},
+	"size": {1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case nil:
+			return int64(0), nil
+		case string:
+			return int64(len(v)), nil
+		case []interface{}:
+			return int64(len(v)), nil
+		case map[string]interface{}:
+			return int64(len(v)), nil
+		}
+		return nil, fmt.Errorf("unsupported argument %T", args[0])
+	}},
+	"startsWith": {2, stringFunc(strings.HasPrefix)},
+	"endsWith":   {2, stringFunc(strings.HasSuffix)},
+	"contains":   {2, stringFunc(strings.Contains)},
+	"matches": {2, func(args []interface{}) (interface{}, error) {
+		s, okS := args[0].(string)
+		pattern, okP := args[1].(string)
+		if !okS || !okP {
+			return nil, fmt.Errorf("want two strings, got %s and %s", describeValue(args[0]), describeValue(args[1]))
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		return re.MatchString(s), nil
+	}},
+	"quantity": {1, func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return resource.ParseQuantity(v)
+		case int64:
+			return *resource.NewQuantity(v, resource.DecimalSI), nil
+		}
+		return nil, fmt.Errorf("want a string, got %s", describeValue(args[0]))
+	}},
+}
+
+func stringFunc(f func(a, b string) bool) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		a, okA := args[0].(string)
+		b, okB := args[1].(string)
+		if !okA || !okB {
+			return nil, fmt.Errorf("want two strings, got %s and %s", describeValue(args[0]), describeValue(args[1]))
+		}
+		return f(a, b), nil
+	}
+}
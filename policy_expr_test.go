@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalExpr(t *testing.T) {
+	env := map[string]interface{}{
+		"object": map[string]interface{}{
+			"kind": "Deployment",
+			"spec": map[string]interface{}{
+				"replicas": int64(2),
+				"containers": []interface{}{
+					map[string]interface{}{"image": "ghcr.io/org/a:1", "limits": map[string]interface{}{"memory": "512Mi"}},
+					map[string]interface{}{"image": "docker.io/b:2"},
+				},
+			},
+		},
+		"app": map[string]interface{}{"exposure": "local"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`object.kind == "Deployment"`, true},
+		{`object.spec.replicas >= 2 && object.spec.replicas < 3.5`, true},
+		{`!has(object.spec.hostNetwork)`, true},
+		{`object.spec.hostNetwork == true`, false},
+		{`object.spec.hostNetwork != true`, true},
+		{`size(object.spec.containers) == 2`, true},
+		{`object.spec.containers[0].image == 'ghcr.io/org/a:1'`, true},
+		{`object.spec.containers[5] == null`, true},
+		{`object["spec"]["replicas"] == 2`, true},
+		{`app.exposure in ["local", "vpn"]`, true},
+		{`"replicas" in object.spec`, true},
+		{`any(object.spec.containers, c, startsWith(c.image, "ghcr.io/"))`, true},
+		{`all(object.spec.containers, c, startsWith(c.image, "ghcr.io/"))`, false},
+		{`all(object.spec.missing, c, false)`, true},
+		{`all(object.spec.containers, c, !has(c.limits.memory) || quantity(c.limits.memory) <= quantity("2Gi"))`, true},
+		{`quantity("3Gi") > quantity("2Gi")`, true},
+		{`quantity("1000m") == quantity("1")`, true},
+		{`matches(object.spec.containers[1].image, "^docker\\.io/")`, true},
+		{`contains("abc", "b") && endsWith("abc", "c")`, true},
+		{`false || (true && !false)`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			e, err := compileExpr(test.expr)
+			if err != nil {
+				t.Fatalf("compileExpr returned error: %v", err)
+			}
+			got, err := evalBool(e, env)
+			if err != nil {
+				t.Fatalf("eval returned error: %v", err)
+			}
+			if got != test.want {
+				t.Fatalf("got %v want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{`object.kind ==`, "unexpected"},
+		{`object.kind = "x"`, "unexpected character"},
+		{`"unterminated`, "unterminated string"},
+		{`nope(1)`, "unknown function"},
+		{`has(1, 2)`, "want 1 arguments"},
+		{`all(object, "c", true)`, "want all(list, variable, predicate)"},
+		{`any()`, "want any(list, variable, predicate)"},
+		{`(true`, `expected ")"`},
+		{`true true`, "unexpected"},
+		{`!matches(app.image, "^(docker\\.io/")`, `matches at offset 1: invalid pattern "^(docker\\.io/"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			_, err := compileExpr(test.expr)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, test.wantErr)
+			}
+		})
+	}
+
+	e, _ := compileExpr(`object.spec.replicas < quantity("1Gi")`)
+	if _, err := evalBool(e, map[string]interface{}{"object": map[string]interface{}{}}); err == nil || !strings.Contains(err.Error(), "cannot compare null") {
+		t.Fatalf("expected comparison error, got %v", err)
+	}
+
+	// A pattern only known at evaluation time fails the evaluation instead
+	// of not matching, so that a negated rule cannot let everything through.
+	e, _ = compileExpr(`!matches(app.image, app.pattern)`)
+	app := map[string]interface{}{"app": map[string]interface{}{"image": "nginx", "pattern": "("}}
+	if _, err := evalBool(e, app); err == nil || !strings.Contains(err.Error(), `matches: invalid pattern "("`) {
+		t.Fatalf("expected pattern error, got %v", err)
+	}
+}
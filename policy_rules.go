@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PolicyRule is a declarative check evaluated against every object rendered
+// for a deployment, including its ArgoCD Application, before anything is
+// committed. The expression is written in the language described in
+// policy_expr.go and sees two variables: object, the rendered object, and
+// app, the deployment request (see policyApp).
+type PolicyRule struct {
+	Name string `yaml:"name"`
+	// Kinds limits the rule to objects of these kinds. Empty matches all.
+	Kinds []string `yaml:"kinds"`
+	// Expression must evaluate to true for the object to pass.
+	Expression string `yaml:"expression"`
+	// Message explains the violation. Defaults to the expression.
+	Message string `yaml:"message"`
+
+	compiled expr
+}
+
+func (r *PolicyRule) compile() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if strings.TrimSpace(r.Expression) == "" {
+		return errors.New("expression is required")
+	}
+	e, err := compileExpr(r.Expression)
+	if err != nil {
+		return fmt.Errorf("invalid expression: %w", err)
+	}
+	r.compiled = e
+	return nil
+}
+
+func (r *PolicyRule) appliesTo(kind string) bool {
+	return len(r.Kinds) == 0 || slices.Contains(r.Kinds, kind)
+}
+
+// policyApp describes the deployment request to policy rules as the app
+// variable.
+type policyApp struct {
+	Name       string
+	Exposure   string
+	Namespace  string
+	Source     string // "image" or "helm"
+	Image      string
+	Chart      string
+	Registry   string
+	Repository string
+}
+
+func (a policyApp) vars() map[string]interface{} {
+	return map[string]interface{}{
+		"name":       a.Name,
+		"exposure":   a.Exposure,
+		"namespace":  a.Namespace,
+		"source":     a.Source,
+		"image":      a.Image,
+		"chart":      a.Chart,
+		"registry":   a.Registry,
+		"repository": a.Repository,
+	}
+}
+
+// imagePolicyApp and helmPolicyApp build the app variable for the two kinds
+// of deployment.
+func imagePolicyApp(appName, exposure, namespace string, ref *imageReference) policyApp {
+	return policyApp{
+		Name:       appName,
+		Exposure:   exposure,
+		Namespace:  namespace,
+		Source:     sourceImage,
+		Image:      ref.String(),
+		Registry:   ref.Registry,
+		Repository: ref.Repository,
+	}
+}
+
+func helmPolicyApp(appName, exposure, namespace string, chart *ArgoHelmSource) policyApp {
+	registry, repository, _ := strings.Cut(chart.RepoURL, "/")
+	return policyApp{
+		Name:       appName,
+		Exposure:   exposure,
+		Namespace:  namespace,
+		Source:     sourceHelm,
+		Chart:      fmt.Sprintf("oci://%s/%s:%s", chart.RepoURL, chart.Chart, chart.TargetRevision),
+		Registry:   registry,
+		Repository: repository + "/" + chart.Chart,
+	}
+}
+
+// checkRules evaluates every rule against every rendered object and returns
+// all violations. An expression that fails to evaluate counts as a violation
+// so that a broken rule never lets a deployment through.
+func (p *Policy) checkRules(app policyApp, files []renderedFile) []*PolicyViolation {
+	if p == nil || len(p.Rules) == 0 {
+		return nil
+	}
+
+	var violations []*PolicyViolation
+	for _, f := range files {
+		for _, obj := range f.Objects {
+			content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+			if err != nil {
+				violations = append(violations, &PolicyViolation{Rule: "rules", Reason: fmt.Sprintf("%s: %v", f.path, err)})
+				continue
+			}
+			u := &unstructured.Unstructured{Object: content}
+			env := map[string]interface{}{"object": content, "app": app.vars()}
+
+			for i := range p.Rules {
+				rule := &p.Rules[i]
+				if !rule.appliesTo(u.GetKind()) {
+					continue
+				}
+				ok, err := evalBool(rule.compiled, env)
+				if ok {
+					continue
+				}
+				reason := rule.Message
+				if reason == "" {
+					reason = "expression " + rule.Expression + " is false"
+				}
+				if err != nil {
+					reason = "evaluation failed: " + err.Error()
+				}
+				violations = append(violations, &PolicyViolation{
+					Rule:   "rules." + rule.Name,
+					Reason: fmt.Sprintf("%s %s: %s", u.GetKind(), u.GetName(), reason),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// enforceRules is checkRules for the deploy tools: it joins the violations
+// into a single error.
+func (p *Policy) enforceRules(app policyApp, files []renderedFile) error {
+	violations := p.checkRules(app, files)
+	errs := make([]error, len(violations))
+	for i, v := range violations {
+		errs[i] = v
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestPolicyCheckImage(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	writeFile(t, file, `
+images:
+  allow:
+    - registry: ghcr.io
+      repository: my-org/**
+    - registry: docker.io
+      repository: library/*
+  forbid-latest: true
+charts:
+  allow:
+    - registry: registry-1.docker.io
+      repository: bitnamicharts/*
+`)
+	policy, err := loadPolicy(file)
+	if err != nil {
+		t.Fatalf("loadPolicy returned error: %v", err)
+	}
+
+	tests := []struct {
+		image    string
+		wantRule string
+	}{
+		{image: "ghcr.io/my-org/team/app:1.0"},
+		{image: "nginx:1.27"},
+		{image: "docker.io/nginx:1.27"},
+		{image: "ghcr.io/my-org/app@sha256:" + strings.Repeat("a", 64)},
+		{image: "ghcr.io/other-org/app:1.0", wantRule: "images.allow"},
+		{image: "someone/app:1.0", wantRule: "images.allow"},
+		{image: "nginx", wantRule: "images.forbid-latest"},
+		{image: "ghcr.io/my-org/app:latest", wantRule: "images.forbid-latest"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			ref, err := parseImageReference(test.image)
+			if err != nil {
+				t.Fatalf("parseImageReference returned error: %v", err)
+			}
+			err = policy.checkImage(ref)
+			if test.wantRule == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var violation *PolicyViolation
+			if !errors.As(err, &violation) || violation.Rule != test.wantRule {
+				t.Fatalf("error = %v, want violation of %s", err, test.wantRule)
+			}
+		})
+	}
+
+	chart, _ := parseOCIHelmChartRef("oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0")
+	if err := policy.checkChart(chart); err != nil {
+		t.Fatalf("allowed chart rejected: %v", err)
+	}
+	chart, _ = parseOCIHelmChartRef("oci://ghcr.io/someone/charts/app:1.0.0")
+	if err := policy.checkChart(chart); err == nil || !strings.Contains(err.Error(), "allowed: registry-1.docker.io/bitnamicharts/*") {
+		t.Fatalf("expected charts.allow violation listing allowed rules, got %v", err)
+	}
+}
+
+func TestLoadPolicyRejectsInvalidFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	writeFile(t, file, "images:\n  allow:\n    - repository: app\n")
+	if _, err := loadPolicy(file); err == nil || !strings.Contains(err.Error(), "registry is required") {
+		t.Fatalf("expected missing registry error, got %v", err)
+	}
+
+	writeFile(t, file, "images:\n  forbidLatest: true\n")
+	if _, err := loadPolicy(file); err == nil {
+		t.Fatal("expected unknown field error, got nil")
+	}
+
+	var nilPolicy *Policy
+	if err := nilPolicy.checkImage(&imageReference{Registry: "docker.io", Repository: "x"}); err != nil {
+		t.Fatalf("nil policy rejected image: %v", err)
+	}
+}
+
+func TestPolicyRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	writeFile(t, file, `
+rules:
+  - name: no-host-network
+    kinds: [Deployment]
+    expression: object.spec.template.spec.hostNetwork != true
+  - name: memory-limit
+    kinds: [Deployment]
+    expression: >-
+      all(object.spec.template.spec.containers, c,
+          !has(c.resources.limits.memory) || quantity(c.resources.limits.memory) <= quantity("2Gi"))
+  - name: internal-registry-local-only
+    expression: app.registry != "registry.internal" || app.exposure == "local"
+    message: images from registry.internal must use exposure=local
+`)
+	policy, err := loadPolicy(file)
+	if err != nil {
+		t.Fatalf("loadPolicy returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	d, _ := newTestDeployer(t, nil)
+	d.policy = policy
+
+	res, _ := d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "registry.internal/team/app:1.0")
+	if !res.IsError || !strings.Contains(resultText(res), "policy violation (rules.internal-registry-local-only): Deployment demo: images from registry.internal must use exposure=local") {
+		t.Fatalf("expected rule violation, got %s", resultText(res))
+	}
+	if readRepoFile(t, d, "argocd-apps/demo.yaml") != "" {
+		t.Fatal("rejected deployment reached Git")
+	}
+
+	res, _ = d.checkPolicy(ctx, "demo", "registry.internal/team/app:1.0", "", exposurePublic, d.cfg.Namespace)
+	if got := resultText(res); res.IsError || strings.Count(got, "❌") != 4 {
+		t.Fatalf("expected one violation per rendered object, got %s", got)
+	}
+
+	res, _ = d.checkPolicy(ctx, "demo", "", "oci://registry-1.docker.io/bitnamicharts/nginx:15.9.0", exposurePublic, d.cfg.Namespace)
+	if got := resultText(res); !strings.Contains(got, "✅ No policy violations") {
+		t.Fatalf("expected chart to pass, got %s", got)
+	}
+
+	res, err = d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposureLocal, Namespace: d.cfg.LocalNamespace}, "registry.internal/team/app:1.0")
+	if err != nil || res.IsError {
+		t.Fatalf("deploy failed: %v %s", err, resultText(res))
+	}
+
+	// Manual edits kept by a redeploy are checked too.
+	editRepoFile(t, d, "manifests/demo/deployment.yaml", func(s string) string {
+		return strings.Replace(s, "    spec:\n      containers:\n", "    spec:\n      hostNetwork: true\n      containers:\n", 1)
+	})
+	res, _ = d.deploy(ctx, deployRequest{AppName: "demo", Exposure: exposureLocal, Namespace: d.cfg.LocalNamespace, Mode: modeUpgrade}, "registry.internal/team/app:1.1")
+	if !res.IsError || !strings.Contains(resultText(res), "rules.no-host-network") {
+		t.Fatalf("expected rule violation for a manual edit, got %s", resultText(res))
+	}
+	if dep := readRepoFile(t, d, "manifests/demo/deployment.yaml"); strings.Contains(dep, "app:1.1") {
+		t.Fatal("rejected redeploy reached Git")
+	}
+
+	files, err := d.renderImageApp(deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "nginx:1.27", Ownership{})
+	if err != nil {
+		t.Fatalf("renderImageApp returned error: %v", err)
+	}
+	spec := files[0].Objects[0].(*appsv1.Deployment).Spec.Template.Spec
+	spec.HostNetwork = true
+	spec.Containers[0].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("4Gi")}
+	files[0].Objects[0].(*appsv1.Deployment).Spec.Template.Spec = spec
+	violations := policy.checkRules(policyApp{}, files)
+	var rules []string
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	if got := strings.Join(rules, ","); got != "rules.no-host-network,rules.memory-limit" {
+		t.Fatalf("violated rules = %s", got)
+	}
+
+	// A pattern that fails to compile at evaluation time is a violation.
+	broken := &Policy{Rules: []PolicyRule{{Name: "pattern-from-name", Expression: `!matches(app.image, app.name)`}}}
+	if err := broken.validate(); err != nil {
+		t.Fatalf("validate returned error: %v", err)
+	}
+	violations = broken.checkRules(policyApp{Name: "(", Image: "nginx:1.27"}, files[:1])
+	if len(violations) != 1 || !strings.Contains(violations[0].Reason, "evaluation failed: matches: invalid pattern") {
+		t.Fatalf("violations = %v", violations)
+	}
+}
+
+func TestLoadPolicyRejectsInvalidRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	writeFile(t, file, "rules:\n  - name: broken\n    expression: object.kind ==\n")
+	if _, err := loadPolicy(file); err == nil || !strings.Contains(err.Error(), "rules[0]: invalid expression") {
+		t.Fatalf("expected invalid expression error, got %v", err)
+	}
+
+	writeFile(t, file, "rules:\n  - name: no-docker-hub\n    expression: '!matches(app.image, \"^(docker\\\\.io/\")'\n")
+	if _, err := loadPolicy(file); err == nil || !strings.Contains(err.Error(), "rules[0]: invalid expression") || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Fatalf("expected invalid pattern error, got %v", err)
+	}
+
+	writeFile(t, file, "rules:\n  - name: a\n    expression: 'true'\n  - name: a\n    expression: 'true'\n")
+	if _, err := loadPolicy(file); err == nil || !strings.Contains(err.Error(), "duplicate rule name") {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+}
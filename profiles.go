@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+)
+
+// defaultProfile is the profile deploy-image uses when none is given: a web
+// app with a Deployment, a Service and an Ingress.
+const defaultProfile = "web"
+
+// workerProfile is the built-in profile for background workers: a Deployment
+// without an HTTP liveness probe, and no Service or Ingress.
+const workerProfile = "worker"
+
+// profilesDir is the directory in --templates-dir holding one subdirectory
+// per profile.
+const profilesDir = "profiles"
+
+// Annotations recording the profile and parameters an image app was
+// deployed with, on its ArgoCD Application.
+const (
+	profileAnnotation    = "mcp-app-deployer/profile"
+	parametersAnnotation = "mcp-app-deployer/parameters"
+)
+
+// Profile is a named bundle of templates rendered by deploy-image for an app
+// of a particular shape. It is declared by profiles/<name>/profile.yaml in
+// --templates-dir.
+type Profile struct {
+	Name        string `yaml:"-"`
+	Description string `yaml:"description"`
+	// Manifests are the template file names to render into manifests/<app>/.
+	// Each is looked up in the profile's directory first, then among the
+	// shared and built-in templates.
+	Manifests []string `yaml:"manifests"`
+	// Parameters is the JSON schema of the parameters the profile accepts,
+	// which templates see as .Params. Nil means it takes none.
+	Parameters map[string]interface{} `yaml:"parameters"`
+
+	// templates are the resolved paths of Manifests in the template FS.
+	templates []string
+	schema    *spec.Schema
+}
+
+// builtinProfiles are available without --templates-dir.
+func builtinProfiles() map[string]*Profile {
+	web := &Profile{
+		Name:        defaultProfile,
+		Description: "Web app with a Deployment, a Service and an Ingress at <app>.<domain>",
+		Manifests:   imageAppTemplates,
+	}
+	for _, name := range web.Manifests {
+		web.templates = append(web.templates, "templates/"+name)
+	}
+	worker := &Profile{
+		Name:        workerProfile,
+		Description: "Background worker or queue consumer: a Deployment without an HTTP liveness probe, and no Service or Ingress",
+		Manifests:   []string{"deployment.yaml"},
+		templates:   []string{"templates/worker/deployment.yaml"},
+	}
+	return map[string]*Profile{web.Name: web, worker.Name: worker}
+}
+
+// loadProfiles returns the built-in profiles together with those declared in
+// dir/profiles, whose templates are parsed from fsys. A declared profile
+// named like a built-in one replaces it.
+func loadProfiles(dir string, fsys fs.FS) (map[string]*Profile, error) {
+	profiles := builtinProfiles()
+	if dir == "" {
+		return profiles, nil
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, profilesDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return profiles, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+
+	var errs []error
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p, err := loadProfile(filepath.Join(dir, profilesDir, e.Name()), e.Name(), fsys)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %w", e.Name(), err))
+			continue
+		}
+		profiles[p.Name] = p
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// withoutProfileTemplates returns the extra templates that no profile lists
+// among its manifests. Those listed are only rendered by their profiles.
+func withoutProfileTemplates(extra []string, profiles map[string]*Profile) []string {
+	return slices.DeleteFunc(slices.Clone(extra), func(name string) bool {
+		for _, p := range profiles {
+			if slices.Contains(p.templates, "templates/"+name) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func loadProfile(dir, name string, fsys fs.FS) (*Profile, error) {
+	if msgs := validation.IsDNS1123Label(name); len(msgs) > 0 {
+		return nil, fmt.Errorf("invalid name: %s", strings.Join(msgs, "; "))
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "profile.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	p := &Profile{Name: name}
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("parse profile.yaml: %w", err)
+	}
+
+	if len(p.Manifests) == 0 {
+		return nil, errors.New("manifests must not be empty")
+	}
+	for _, m := range p.Manifests {
+		if m != path.Base(m) || path.Ext(m) != ".yaml" && path.Ext(m) != ".yml" {
+			return nil, fmt.Errorf("manifest %q must be a .yaml file name", m)
+		}
+		tmplPath := path.Join("templates", profilesDir, name, m)
+		if _, err := fs.Stat(fsys, tmplPath); err != nil {
+			tmplPath = "templates/" + m
+		}
+		if _, err := parseTemplate(fsys, tmplPath); err != nil {
+			return nil, err
+		}
+		p.templates = append(p.templates, tmplPath)
+	}
+
+	if p.Parameters != nil {
+		raw, err := json.Marshal(p.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("parameters: %w", err)
+		}
+		p.schema = &spec.Schema{}
+		if err := json.Unmarshal(raw, p.schema); err != nil {
+			return nil, fmt.Errorf("parameters is not a JSON schema: %w", err)
+		}
+		if !p.schema.Type.Contains("object") {
+			return nil, errors.New(`parameters must be a JSON schema of type "object"`)
+		}
+	}
+	return p, nil
+}
+
+// params validates the parameters given for an app against the profile's
+// schema and returns them with the schema's top-level defaults filled in.
+func (p *Profile) params(given map[string]interface{}) (map[string]interface{}, error) {
+	if p.schema == nil {
+		if len(given) > 0 {
+			return nil, fmt.Errorf("profile %s takes no parameters", p.Name)
+		}
+		return map[string]interface{}{}, nil
+	}
+
+	params := make(map[string]interface{}, len(p.schema.Properties))
+	for name, prop := range p.schema.Properties {
+		if prop.Default != nil {
+			params[name] = prop.Default
+		}
+	}
+	for k, v := range given {
+		params[k] = v
+	}
+
+	result := validate.NewSchemaValidator(p.schema, nil, "parameters", strfmt.Default).Validate(params)
+	if len(result.Errors) > 0 {
+		errs := make([]error, len(result.Errors))
+		copy(errs, result.Errors)
+		return nil, fmt.Errorf("invalid parameters for profile %s: %w", p.Name, errors.Join(errs...))
+	}
+	return params, nil
+}
+
+// profileNames returns the names of profiles, sorted.
+func profileNames(profiles map[string]*Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// describeProfiles lists every profile with its description and parameter
+// schema, for the deploy-image tool description.
+func describeProfiles(profiles map[string]*Profile) string {
+	var b strings.Builder
+	for _, name := range profileNames(profiles) {
+		p := profiles[name]
+		fmt.Fprintf(&b, "\n- %s: %s.", name, strings.TrimSuffix(p.Description, "."))
+		if p.Parameters != nil {
+			schema, _ := json.Marshal(p.Parameters)
+			fmt.Fprintf(&b, " Parameters schema: %s", schema)
+		} else {
+			b.WriteString(" Takes no parameters.")
+		}
+	}
+	return b.String()
+}
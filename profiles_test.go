@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const queueProfile = `description: Queue consumer without a Service or Ingress
+manifests: [deployment.yaml, queue-config.yaml]
+parameters:
+  type: object
+  additionalProperties: false
+  properties:
+    replicas:
+      type: integer
+      minimum: 1
+      default: 1
+`
+
+const queueDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+spec:
+  replicas: {{ .Params.replicas }}
+  selector:
+    matchLabels:
+      app: {{ .Name }}
+  template:
+    metadata:
+      labels:
+        app: {{ .Name }}
+    spec:
+      containers:
+      - name: {{ .Name }}
+        image: {{ .Image }}
+`
+
+// queueConfig is a shared template in --templates-dir that only the queue
+// profile lists.
+const queueConfig = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Name }}-queue
+  namespace: {{ .Namespace }}
+data:
+  queue: {{ .Name }}
+`
+
+func newProfilesDeployer(t *testing.T) *Deployer {
+	t.Helper()
+	dir := t.TempDir()
+	queueDir := filepath.Join(dir, profilesDir, "queue")
+	if err := os.MkdirAll(queueDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"profile.yaml": queueProfile, "deployment.yaml": queueDeployment} {
+		if err := os.WriteFile(filepath.Join(queueDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "queue-config.yaml"), []byte(queueConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys, extra, err := loadTemplates(dir)
+	if err != nil {
+		t.Fatalf("loadTemplates returned error: %v", err)
+	}
+	profiles, err := loadProfiles(dir, fsys)
+	if err != nil {
+		t.Fatalf("loadProfiles returned error: %v", err)
+	}
+	if extra = withoutProfileTemplates(extra, profiles); len(extra) != 0 {
+		t.Fatalf("extra templates = %v, want none besides the queue profile's", extra)
+	}
+
+	d, _ := newTestDeployer(t, nil)
+	d.templates, d.extraTemplates, d.profiles = fsys, extra, profiles
+	return d
+}
+
+func TestDeployWithProfile(t *testing.T) {
+	ctx := context.Background()
+	d := newProfilesDeployer(t)
+
+	if got := describeProfiles(d.profiles); !strings.Contains(got, "- web: ") || !strings.Contains(got, `- queue: Queue consumer without a Service or Ingress. Parameters schema: {"additionalProperties":false`) {
+		t.Fatalf("unexpected profile description:%s", got)
+	}
+
+	req := deployRequest{AppName: "jobs", Exposure: exposurePublic, Namespace: d.cfg.Namespace, Profile: "queue", Parameters: map[string]interface{}{"replicas": 0.0}}
+	if res := must(t)(d.deploy(ctx, req, "busybox:1.36")); !res.IsError || !strings.Contains(resultText(res), "replicas") {
+		t.Fatalf("replicas 0 accepted: %s", resultText(res))
+	}
+	req.Parameters = map[string]interface{}{"replicas": 3.0}
+	if res := must(t)(d.deploy(ctx, req, "busybox:1.36")); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+
+	if deployment := readRepoFile(t, d, "manifests/jobs/deployment.yaml"); !strings.Contains(deployment, "replicas: 3") || strings.Contains(deployment, "livenessProbe") {
+		t.Fatalf("profile deployment template not used:\n%s", deployment)
+	}
+	if svc := readRepoFile(t, d, "manifests/jobs/service.yaml"); svc != "" {
+		t.Fatalf("queue profile rendered a service:\n%s", svc)
+	}
+	if cm := readRepoFile(t, d, "manifests/jobs/queue-config.yaml"); strings.Count(cm, "kind: ConfigMap") != 1 {
+		t.Fatalf("unexpected shared profile template:\n%s", cm)
+	}
+	if app := readRepoFile(t, d, "argocd-apps/jobs.yaml"); !strings.Contains(app, `mcp-app-deployer/profile: "queue"`) || !strings.Contains(app, `mcp-app-deployer/parameters: "{\"replicas\":3}"`) {
+		t.Fatalf("profile not recorded on the application:\n%s", app)
+	}
+
+	// Upgrades keep the parameters unless given, and refuse another profile.
+	if res := must(t)(d.deploy(ctx, deployRequest{AppName: "jobs", Exposure: exposurePublic, Namespace: d.cfg.Namespace, Profile: "queue", Mode: modeUpgrade}, "busybox:1.37")); res.IsError {
+		t.Fatalf("upgrade failed: %s", resultText(res))
+	}
+	if deployment := readRepoFile(t, d, "manifests/jobs/deployment.yaml"); !strings.Contains(deployment, "replicas: 3") || !strings.Contains(deployment, "busybox:1.37") {
+		t.Fatalf("upgrade lost the parameters:\n%s", deployment)
+	}
+	res := must(t)(d.deploy(ctx, deployRequest{AppName: "jobs", Exposure: exposurePublic, Namespace: d.cfg.Namespace, Profile: defaultProfile, Mode: modeUpgrade}, "busybox:1.37"))
+	if !res.IsError || !strings.Contains(resultText(res), "profile queue") {
+		t.Fatalf("upgrade changed the profile: %s", resultText(res))
+	}
+
+	res = must(t)(d.deploy(ctx, deployRequest{AppName: "web", Exposure: exposurePublic, Namespace: d.cfg.Namespace, Parameters: map[string]interface{}{"replicas": 2.0}}, "nginx:1.27"))
+	if !res.IsError || !strings.Contains(resultText(res), "takes no parameters") {
+		t.Fatalf("parameters accepted by the web profile: %s", resultText(res))
+	}
+	if res := must(t)(d.deploy(ctx, deployRequest{AppName: "web", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "nginx:1.27")); res.IsError {
+		t.Fatalf("deploy failed: %s", resultText(res))
+	}
+	if cm := readRepoFile(t, d, "manifests/web/queue-config.yaml"); cm != "" {
+		t.Fatalf("web app rendered the queue profile's template:\n%s", cm)
+	}
+}
+
+func TestLoadProfilesRejectsInvalidProfiles(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":     "manifests: [deployment.yaml]\nreplicas: 2\n",
+		"no manifests":      "description: empty\n",
+		"path in manifests": "manifests: [../deployment.yaml]\n",
+		"missing template":  "manifests: [missing.yaml]\n",
+		"non-object schema": "manifests: [deployment.yaml]\nparameters:\n  type: string\n",
+	}
+	for name, profile := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, profilesDir, "broken"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dir, profilesDir, "broken", "profile.yaml"), []byte(profile), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fsys, _, err := loadTemplates(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadProfiles(dir, fsys); err == nil || !strings.Contains(err.Error(), "profile broken") {
+				t.Fatalf("loadProfiles error = %v", err)
+			}
+		})
+	}
+}
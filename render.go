@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// manifest is a rendered template together with the Kubernetes objects
+// decoded from it.
+type manifest struct {
+	Content []byte
+	Objects []runtime.Object
+}
+
+// typedKinds maps apiVersion/kind to the client-go type rendered documents of
+// that kind are strictly decoded into. Anything else is decoded as
+// unstructured and only has its metadata checked; ArgoCD Applications are
+// additionally checked by validateApplication.
+var typedKinds = map[string]func() runtime.Object{
+	"apps/v1/Deployment":                 func() runtime.Object { return &appsv1.Deployment{} },
+	"v1/Service":                         func() runtime.Object { return &corev1.Service{} },
+	"v1/Secret":                          func() runtime.Object { return &corev1.Secret{} },
+	"networking.k8s.io/v1/Ingress":       func() runtime.Object { return &networkingv1.Ingress{} },
+	"networking.k8s.io/v1/NetworkPolicy": func() runtime.Object { return &networkingv1.NetworkPolicy{} },
+	"batch/v1/CronJob":                   func() runtime.Object { return &batchv1.CronJob{} },
+	"batch/v1/Job":                       func() runtime.Object { return &batchv1.Job{} },
+}
+
+// renderManifest executes a template and decodes every YAML document in the
+// output into a typed object, rejecting output that is not valid YAML, has
+// unknown or mistyped fields, or fails the checks in validateObject. Nothing
+// invalid ever reaches the GitOps repository.
+func renderManifest(fsys fs.FS, templatePath string, data interface{}) (*manifest, error) {
+	content, err := renderTemplate(fsys, templatePath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := decodeManifest(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s rendered invalid manifest: %w", templatePath, err)
+	}
+
+	return &manifest{Content: content, Objects: objects}, nil
+}
+
+func renderTemplate(fsys fs.FS, templatePath string, data interface{}) ([]byte, error) {
+	tmpl, err := parseTemplate(fsys, templatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("execute %s: %w", templatePath, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeManifest splits content into YAML documents and decodes each one.
+func decodeManifest(content []byte) ([]runtime.Object, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(content)))
+	var objects []runtime.Object
+	for i := 0; ; i++ {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, err := decodeObject(doc)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		objects = append(objects, obj)
+	}
+
+	if len(objects) == 0 {
+		return nil, errors.New("no objects")
+	}
+	return objects, nil
+}
+
+func decodeObject(doc []byte) (runtime.Object, error) {
+	u := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal(doc, &u.Object); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if u.GetAPIVersion() == "" || u.GetKind() == "" {
+		return nil, errors.New("apiVersion and kind are required")
+	}
+
+	var obj runtime.Object = u
+	if newObj := typedKinds[u.GetAPIVersion()+"/"+u.GetKind()]; newObj != nil {
+		obj = newObj()
+		if err := yaml.UnmarshalStrict(doc, obj); err != nil {
+			return nil, fmt.Errorf("%s: %w", u.GetKind(), err)
+		}
+	}
+
+	if err := validateObject(obj); err != nil {
+		return nil, fmt.Errorf("%s %q: %w", u.GetKind(), u.GetName(), err)
+	}
+	return obj, nil
+}
+
+// validateObject performs the subset of API server validation that catches
+// mistakes in template input: names, namespaces, hosts, images and CIDRs.
+func validateObject(obj runtime.Object) error {
+	var errs []string
+	check := func(field string, msgs []string) {
+		for _, m := range msgs {
+			errs = append(errs, fmt.Sprintf("%s: %s", field, m))
+		}
+	}
+
+	meta, ok := obj.(metav1.Object)
+	if !ok {
+		return fmt.Errorf("unsupported object %T", obj)
+	}
+	check("metadata.name", validation.IsDNS1123Subdomain(meta.GetName()))
+	if ns := meta.GetNamespace(); ns != "" {
+		check("metadata.namespace", validation.IsDNS1123Label(ns))
+	}
+
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		if o.Spec.Selector == nil || !labels.SelectorFromSet(o.Spec.Selector.MatchLabels).Matches(labels.Set(o.Spec.Template.Labels)) {
+			errs = append(errs, "spec.selector does not match spec.template.metadata.labels")
+		}
+		errs = append(errs, validateContainers("spec.template.spec.containers", o.Spec.Template.Spec.Containers)...)
+	case *batchv1.CronJob:
+		if err := validateSchedule(o.Spec.Schedule); err != nil {
+			errs = append(errs, "spec.schedule: "+err.Error())
+		}
+		errs = append(errs, validateContainers("spec.jobTemplate.spec.template.spec.containers", o.Spec.JobTemplate.Spec.Template.Spec.Containers)...)
+	case *batchv1.Job:
+		errs = append(errs, validateContainers("spec.template.spec.containers", o.Spec.Template.Spec.Containers)...)
+	case *corev1.Service:
+		check("metadata.name", validation.IsDNS1035Label(o.Name))
+		for i, p := range o.Spec.Ports {
+			check(fmt.Sprintf("spec.ports[%d].port", i), validation.IsValidPortNum(int(p.Port)))
+		}
+	case *networkingv1.Ingress:
+		for i, rule := range o.Spec.Rules {
+			check(fmt.Sprintf("spec.rules[%d].host", i), validation.IsDNS1123Subdomain(rule.Host))
+		}
+		for i, tls := range o.Spec.TLS {
+			check(fmt.Sprintf("spec.tls[%d].secretName", i), validation.IsDNS1123Subdomain(tls.SecretName))
+		}
+	case *networkingv1.NetworkPolicy:
+		var peers []networkingv1.NetworkPolicyPeer
+		for _, rule := range o.Spec.Ingress {
+			peers = append(peers, rule.From...)
+		}
+		for _, rule := range o.Spec.Egress {
+			peers = append(peers, rule.To...)
+		}
+		for _, peer := range peers {
+			if peer.IPBlock != nil {
+				if _, _, err := net.ParseCIDR(peer.IPBlock.CIDR); err != nil {
+					errs = append(errs, fmt.Sprintf("ipBlock.cidr: %q is not a valid CIDR", peer.IPBlock.CIDR))
+				}
+			}
+		}
+	case *unstructured.Unstructured:
+		if o.GetKind() == "Application" {
+			errs = append(errs, validateApplication(o)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// validateContainers checks the names and images of a pod template's
+// containers, of which there must be at least one.
+func validateContainers(field string, containers []corev1.Container) []string {
+	if len(containers) == 0 {
+		return []string{field + " must not be empty"}
+	}
+	var errs []string
+	for i, c := range containers {
+		field := fmt.Sprintf("%s[%d]", field, i)
+		for _, m := range validation.IsDNS1123Label(c.Name) {
+			errs = append(errs, fmt.Sprintf("%s.name: %s", field, m))
+		}
+		if c.Image == "" || strings.ContainsAny(c.Image, " \t\n") {
+			errs = append(errs, fmt.Sprintf("%s.image: invalid image reference %q", field, c.Image))
+		}
+	}
+	return errs
+}
+
+func validateApplication(app *unstructured.Unstructured) []string {
+	var errs []string
+	destNs, _, _ := unstructured.NestedString(app.Object, "spec", "destination", "namespace")
+	for _, m := range validation.IsDNS1123Label(destNs) {
+		errs = append(errs, "spec.destination.namespace: "+m)
+	}
+	if repoURL, _, _ := unstructured.NestedString(app.Object, "spec", "source", "repoURL"); repoURL == "" {
+		errs = append(errs, "spec.source.repoURL must not be empty")
+	}
+	_, hasPath, _ := unstructured.NestedString(app.Object, "spec", "source", "path")
+	_, hasChart, _ := unstructured.NestedString(app.Object, "spec", "source", "chart")
+	if hasPath == hasChart {
+		errs = append(errs, "spec.source must set exactly one of path and chart")
+	}
+	return errs
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+var testImageData = ImageManifestData{
+	Ownership:    Ownership{Owner: "alice"},
+	Name:         "demo-app",
+	Image:        "registry.example.com:5000/team/demo:1.2.3",
+	Namespace:    "applications",
+	Domain:       "example.com",
+	RepoURL:      "https://github.com/example/gitops",
+	ManifestPath: "manifests",
+}
+
+var testJobData = JobManifestData{
+	Ownership:                  Ownership{Owner: "alice"},
+	Name:                       "nightly-backup",
+	Image:                      "registry.example.com/team/backup:2.0",
+	Namespace:                  "applications",
+	Command:                    []string{"/bin/backup", "--target", "s3://bucket/path with spaces"},
+	Schedule:                   "0 3 * * *",
+	ConcurrencyPolicy:          "Forbid",
+	SuccessfulJobsHistoryLimit: 3,
+	FailedJobsHistoryLimit:     1,
+	BackoffLimit:               2,
+	RunAt:                      "2026-01-02T03:04:05Z",
+}
+
+var testEgressData = EgressManifestData{
+	Ownership: Ownership{Owner: "alice"},
+	Name:      "demo-app",
+	Namespace: "applications",
+	Egress: &EgressPolicy{
+		CIDRs:      []string{"10.0.0.0/8"},
+		Namespaces: []string{"databases"},
+		Ports:      []EgressPort{{Port: 443, Protocol: "TCP"}, {Port: 5432, Protocol: "TCP"}},
+	},
+}
+
+func withTLSIssuer(data ImageManifestData, issuer string) ImageManifestData {
+	data.TLSIssuer = issuer
+	return data
+}
+
+func withBasicAuth(data ImageManifestData, htpasswd string) ImageManifestData {
+	data.BasicAuth = htpasswd
+	return data
+}
+
+// testCustomIngressData uses every Ingress option: a class, aliases
+// including an apex domain, a path prefix, annotations, TLS and a source
+// allowlist.
+func testCustomIngressData() ImageManifestData {
+	data := withTLSIssuer(testImageData, "letsencrypt")
+	data.IngressClass = "nginx"
+	data.Aliases = []string{"demo.example.org", "example.org"}
+	data.Path = "/api"
+	data.IngressAnnotations = map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-body-size":    "50m",
+		"nginx.ingress.kubernetes.io/proxy-read-timeout": "300",
+	}
+	data.AllowedCIDRs = []string{"198.51.100.0/24", "203.0.113.7/32"}
+	data.AllowlistAnnotation = "nginx.ingress.kubernetes.io/whitelist-source-range"
+	return data
+}
+
+func TestRenderManifestGolden(t *testing.T) {
+	tests := []struct {
+		golden   string
+		template string
+		data     interface{}
+	}{
+		{"deployment.yaml", "templates/deployment.yaml", testImageData},
+		{"service.yaml", "templates/service.yaml", testImageData},
+		{"ingress.yaml", "templates/ingress.yaml", testImageData},
+		{"ingress-tls.yaml", "templates/ingress.yaml", withTLSIssuer(testImageData, "letsencrypt")},
+		{"ingress-custom.yaml", "templates/ingress.yaml", testCustomIngressData()},
+		{"app-networkpolicy.yaml", "templates/app-networkpolicy.yaml", testCustomIngressData()},
+		{"app-egress-networkpolicy.yaml", "templates/app-egress-networkpolicy.yaml", testEgressData},
+		{"basic-auth-secret.yaml", "templates/basic-auth-secret.yaml", withBasicAuth(testImageData, "demo-app:$2a$10$MkWn8vnrvV/xC.FXT9dLDuY5MHmL/8MQbRCtiUSTEbKCj3QlDhRqy")},
+		{"worker-deployment.yaml", "templates/worker/deployment.yaml", testImageData},
+		{"cronjob.yaml", "templates/cronjob.yaml", testJobData},
+		{"job.yaml", "templates/job.yaml", testJobData},
+		{
+			"networkpolicy.yaml", "templates/networkpolicy.yaml",
+			struct {
+				Namespace      string
+				AllowedSubnets []string
+			}{"applications-local", []string{"192.168.1.0/24", "10.0.0.0/8"}},
+		},
+		{
+			"application-git.yaml", "templates/application.yaml",
+			ArgoApplicationData{
+				Name:      "demo-app",
+				Namespace: "applications",
+				Git: &ArgoGitSource{
+					RepoURL:        "https://github.com/example/gitops",
+					TargetRevision: "HEAD",
+					Path:           "manifests/demo-app",
+				},
+			},
+		},
+		{
+			"application-helm.yaml", "templates/application-helm.yaml",
+			ArgoApplicationData{
+				Ownership: Ownership{Owner: "alice", Protected: true},
+				Name:      "demo-app",
+				Namespace: "applications-local",
+				Helm: &ArgoHelmSource{
+					RepoURL:        "registry-1.docker.io/bitnamicharts",
+					Chart:          "nginx",
+					TargetRevision: "15.9.0",
+					ReleaseName:    "demo-app",
+					IngressName:    "demo-app",
+					IngressHost:    "demo-app.example.com",
+					TLSIssuer:      "letsencrypt",
+					IngressClass:   "nginx",
+				},
+				HelmParameters: helmAnnotationParams(map[string]string{"nginx.ingress.kubernetes.io/proxy-body-size": "50m"}),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.golden, func(t *testing.T) {
+			m, err := renderManifest(templatesFS, test.template, test.data)
+			if err != nil {
+				t.Fatalf("renderManifest returned error: %v", err)
+			}
+			assertGolden(t, test.golden, m.Content)
+		})
+	}
+}
+
+func TestRenderManifestDecodesTypedObjects(t *testing.T) {
+	m, err := renderManifest(templatesFS, "templates/deployment.yaml", testImageData)
+	if err != nil {
+		t.Fatalf("renderManifest returned error: %v", err)
+	}
+	deployment, ok := m.Objects[0].(*appsv1.Deployment)
+	if !ok {
+		t.Fatalf("decoded %T, want *appsv1.Deployment", m.Objects[0])
+	}
+	if got := deployment.Spec.Template.Spec.Containers[0].Image; got != testImageData.Image {
+		t.Fatalf("image = %q, want %q", got, testImageData.Image)
+	}
+
+	m, err = renderManifest(templatesFS, "templates/ingress.yaml", testImageData)
+	if err != nil {
+		t.Fatalf("renderManifest returned error: %v", err)
+	}
+	if _, ok := m.Objects[0].(*networkingv1.Ingress); !ok {
+		t.Fatalf("decoded %T, want *networkingv1.Ingress", m.Objects[0])
+	}
+
+	m, err = renderManifest(templatesFS, "templates/application.yaml", ArgoApplicationData{
+		Name:      "demo-app",
+		Namespace: "applications",
+		Git:       &ArgoGitSource{RepoURL: "https://github.com/example/gitops", TargetRevision: "HEAD", Path: "manifests/demo-app"},
+	})
+	if err != nil {
+		t.Fatalf("renderManifest returned error: %v", err)
+	}
+	if _, ok := m.Objects[0].(*unstructured.Unstructured); !ok {
+		t.Fatalf("decoded %T, want *unstructured.Unstructured", m.Objects[0])
+	}
+}
+
+func TestRenderManifestRejectsInvalidOutput(t *testing.T) {
+	withData := func(mutate func(*ImageManifestData)) ImageManifestData {
+		data := testImageData
+		mutate(&data)
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		wantErr  string
+	}{
+		{
+			name:     "uppercase app name",
+			template: "templates/deployment.yaml",
+			data:     withData(func(d *ImageManifestData) { d.Name = "DemoApp" }),
+			wantErr:  "metadata.name",
+		},
+		{
+			name:     "image breaking yaml",
+			template: "templates/deployment.yaml",
+			data:     withData(func(d *ImageManifestData) { d.Image = "nginx: latest" }),
+			wantErr:  "invalid YAML",
+		},
+		{
+			name:     "service name starting with digit",
+			template: "templates/service.yaml",
+			data:     withData(func(d *ImageManifestData) { d.Name = "1app" }),
+			wantErr:  "metadata.name",
+		},
+		{
+			name:     "invalid ingress host",
+			template: "templates/ingress.yaml",
+			data:     withData(func(d *ImageManifestData) { d.Domain = "Example_Com" }),
+			wantErr:  "spec.rules[0].host",
+		},
+		{
+			name:     "invalid schedule",
+			template: "templates/cronjob.yaml",
+			data:     JobManifestData{Name: "backup", Image: "backup:1", Namespace: "applications", Schedule: "every day", ConcurrencyPolicy: "Allow"},
+			wantErr:  "spec.schedule",
+		},
+		{
+			name:     "invalid subnet",
+			template: "templates/networkpolicy.yaml",
+			data: struct {
+				Namespace      string
+				AllowedSubnets []string
+			}{"applications-local", []string{"10.0.0.0/33"}},
+			wantErr: "not a valid CIDR",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := renderManifest(templatesFS, test.template, test.data)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("error %q does not mention %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// assertGolden compares got with testdata/golden/<name>, rewriting the file
+// instead when the test runs with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("create golden dir: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (run go test -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s does not match golden file (run go test -update to accept):\n--- got\n%s\n--- want\n%s", name, got, want)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// setExposure moves an app between the public namespace (exposure=public)
+// and the local namespace (exposure=local) in a single commit, rewriting the
+// namespace of its manifests and ArgoCD Application and reconciling the local
+// namespace's NetworkPolicy. Everything else about the app, manual edits
+// included, is kept. ArgoCD then creates the app in the new namespace and
+// prunes it from the old one, which setExposure waits for. Changing the
+// exposure of an app within the public namespace, e.g. removing its
+// authentication, is left to an upgrade, and authenticated apps must have
+// their authentication removed before moving to the local namespace.
+func (d *Deployer) setExposure(ctx context.Context, appName, exposure, namespace string, dryRun bool) (*mcp.CallToolResult, error) {
+	ws, err := d.checkout(ctx)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
+	}
+	defer ws.close()
+
+	existing, err := d.readExistingApp(ws, appName)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
+	}
+	if existing == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("app %s does not exist", appName)), nil
+	}
+	if err := existing.authorize(callerFrom(ctx), appName); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if existing.Source == sourceCronJob || existing.Source == sourceJob {
+		kind := "CronJob"
+		if existing.Source == sourceJob {
+			kind = "Job"
+		}
+		return mcp.NewToolResultError(fmt.Sprintf("app %s is a %s, which always runs in namespace %s; set-exposure only moves image and Helm apps", appName, kind, d.cfg.Namespace)), nil
+	}
+	tool := "deploy-image"
+	if existing.Source == sourceHelm {
+		tool = "deploy-helmchart"
+	}
+	from := existing.Namespace
+	if from == namespace {
+		current := d.existingExposure(existing)
+		if current != exposure {
+			return mcp.NewToolResultError(fmt.Sprintf("app %s is deployed in namespace %s with exposure=%s; set-exposure only moves apps between namespaces, redeploy it with %s mode=%s exposure=%s to change its exposure", appName, namespace, current, tool, modeUpgrade, exposure)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("App %s is already deployed in namespace %s (exposure=%s).", appName, namespace, current)), nil
+	}
+	if existing.Auth != "" && namespace == d.cfg.LocalNamespace {
+		return mcp.NewToolResultError(fmt.Sprintf("app %s has exposure=%s and cannot be moved to exposure=%s with its authentication; remove it with %s mode=%s exposure=%s first", appName, exposureAuthenticated, exposureLocal, tool, modeUpgrade, exposurePublic)), nil
+	}
+	// The Ingress, or its absence, moves with the app.
+	moved := *existing
+	moved.Namespace = namespace
+	exposure = d.existingExposure(&moved)
+
+	if err := d.checkLocalAllowlist(namespace, existing.AllowedCIDRs); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	files, err := d.moveApp(ws, appName, from, namespace)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to move %s: %v", appName, err)), nil
+	}
+	app, err := existing.policyApp(appName, exposure, namespace)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if err := d.policy.enforceRules(app, files); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if err := d.reconcileLocalNetworkPolicy(ws); err != nil && (exposure == exposureLocal || !errors.Is(err, errLocalSubnetsUnset)) {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to render local network policy: %v", err)), nil
+	}
+
+	if dryRun {
+		return dryRunResult(ws, fmt.Sprintf("moving %s to namespace %s", appName, namespace))
+	}
+
+	commitMsg := fmt.Sprintf("Move application %s from namespace %s to %s", appName, from, namespace)
+	if err := d.commitAndPush(ctx, ws, commitMsg); err == errNoChanges {
+		return mcp.NewToolResultError(fmt.Sprintf("No manifest of %s sets namespace %s; redeploy it with mode=%s instead", appName, from, modeReplace)), nil
+	} else if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to %v", err)), nil
+	}
+
+	if err := d.waitForAppPruned(ctx, appName, from, d.argoTimeout, d.pollInterval); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Git updated but ArgoCD has not pruned %s from namespace %s: %v", appName, from, err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Successfully moved %s from namespace %s to %s (exposure=%s). ArgoCD pruned it from %s.", appName, from, namespace, exposure, from)), nil
+}
+
+// existingExposure is the exposure an existing app is deployed with.
+func (d *Deployer) existingExposure(a *existingApp) string {
+	switch {
+	case a.Auth != "":
+		return exposureAuthenticated
+	case a.Namespace == d.cfg.LocalNamespace:
+		return exposureLocal
+	case !a.HasIngress:
+		return exposureNone
+	}
+	return exposurePublic
+}
+
+// moveApp rewrites the namespace fields holding from to to in the manifests
+// and ArgoCD Application of appName in ws, and in their generated copies so
+// that later deploys still merge manual edits. It returns the rewritten
+// manifests.
+func (d *Deployer) moveApp(ws *workspace, appName, from, to string) ([]renderedFile, error) {
+	paths, err := ws.walk(path.Join(d.cfg.ManifestPath, appName))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, d.argoAppFile(appName))
+
+	field := namespaceField(from)
+	var files []renderedFile
+	for _, p := range paths {
+		for _, rel := range []string{p, generatedCopy(appName, p)} {
+			raw, err := ws.readFile(rel)
+			if errors.Is(err, fs.ErrNotExist) && rel != p {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			moved := field.ReplaceAll(raw, []byte("${1}${2}"+to+"${3}"))
+			if rel == p {
+				objects, err := decodeManifest(moved)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", p, err)
+				}
+				files = append(files, renderedFile{path: p, manifest: &manifest{Content: moved, Objects: objects}})
+			}
+			if err := ws.writeFile(rel, moved); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// namespaceField matches the YAML fields setting namespace ns, such as
+// metadata.namespace and an Application's spec.destination.namespace, with
+// the value quoted or not.
+func namespaceField(ns string) *regexp.Regexp {
+	return regexp.MustCompile(`(?m)^([ \t]*(?:- )?namespace:[ \t]*)(["']?)` + regexp.QuoteMeta(ns) + `(["']?)[ \t]*$`)
+}
+
+// walk returns the repository paths of the files below dir, or none if it
+// does not exist.
+func (ws *workspace) walk(dir string) ([]string, error) {
+	root, err := ws.abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	err = filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == root {
+			return fs.SkipAll
+		}
+		if err != nil || e.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(ws.dir, p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	return paths, err
+}
+
+// policyApp describes the existing app to policy rules as if deployed with
+// exposure into namespace.
+func (a *existingApp) policyApp(appName, exposure, namespace string) (policyApp, error) {
+	if a.Source == sourceHelm {
+		chart, err := parseOCIHelmChartRef(a.Chart)
+		if err != nil {
+			return policyApp{}, fmt.Errorf("cannot check the policy for chart %s of %s: %v", a.Chart, appName, err)
+		}
+		return helmPolicyApp(appName, exposure, namespace, chart), nil
+	}
+	ref, err := parseImageReference(a.Image)
+	if err != nil {
+		return policyApp{}, fmt.Errorf("cannot check the policy for image %s of %s: %v", a.Image, appName, err)
+	}
+	app := imagePolicyApp(appName, exposure, namespace, ref)
+	app.Source = a.Source
+	return app, nil
+}
+
+// waitForAppPruned polls until no workload, Service, Ingress or Pod of
+// appName is left in namespace.
+func (d *Deployer) waitForAppPruned(ctx context.Context, appName, namespace string, timeout, interval time.Duration) error {
+	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastState string
+	for {
+		left, err := d.appResources(deadlineCtx, appName, namespace)
+		switch {
+		case err != nil:
+			lastState = err.Error()
+		case len(left) == 0:
+			return nil
+		default:
+			lastState = "still present: " + strings.Join(left, ", ")
+		}
+
+		select {
+		case <-deadlineCtx.Done():
+			return fmt.Errorf("timed out after %s, %s", timeout, lastState)
+		case <-ticker.C:
+		}
+	}
+}
+
+// appResources lists, as Kind/name, the workloads, Services, Ingresses and
+// Pods of appName in namespace: those named after it or labelled with it,
+// as the rendered templates and most Helm charts do.
+func (d *Deployer) appResources(ctx context.Context, appName, namespace string) ([]string, error) {
+	opts := metav1.ListOptions{}
+	listers := []struct {
+		kind string
+		list func() (runtime.Object, error)
+	}{
+		{"Deployment", func() (runtime.Object, error) { return d.kube.AppsV1().Deployments(namespace).List(ctx, opts) }},
+		{"StatefulSet", func() (runtime.Object, error) { return d.kube.AppsV1().StatefulSets(namespace).List(ctx, opts) }},
+		{"CronJob", func() (runtime.Object, error) { return d.kube.BatchV1().CronJobs(namespace).List(ctx, opts) }},
+		{"Job", func() (runtime.Object, error) { return d.kube.BatchV1().Jobs(namespace).List(ctx, opts) }},
+		{"Service", func() (runtime.Object, error) { return d.kube.CoreV1().Services(namespace).List(ctx, opts) }},
+		{"Ingress", func() (runtime.Object, error) { return d.kube.NetworkingV1().Ingresses(namespace).List(ctx, opts) }},
+		{"Pod", func() (runtime.Object, error) { return d.kube.CoreV1().Pods(namespace).List(ctx, opts) }},
+	}
+
+	var found []string
+	for _, l := range listers {
+		list, err := l.list()
+		if err != nil {
+			return nil, fmt.Errorf("list %ss in %s: %w", l.kind, namespace, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			obj, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			labels := obj.GetLabels()
+			if obj.GetName() == appName || labels["app"] == appName || labels["app.kubernetes.io/instance"] == appName {
+				found = append(found, l.kind+"/"+obj.GetName())
+			}
+		}
+	}
+	slices.Sort(found)
+	return found, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetExposure(t *testing.T) {
+	h := newHarness(t)
+	const deployment = "manifests/api/deployment.yaml"
+	npApp := "argocd-apps/" + localNetworkPolicyAppName + ".yaml"
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.27"}, false)
+	editRepoFile(t, h.d, deployment, func(s string) string {
+		return strings.Replace(s, "replicas: 1", "replicas: 2", 1)
+	})
+
+	out := h.call("set-exposure", map[string]interface{}{"app_name": "api", "exposure": exposureLocal, "dry_run": true}, false)
+	if !strings.Contains(out, "+  namespace: applications-local") || !strings.Contains(out, npApp) {
+		t.Fatalf("dry run does not show the move:\n%s", out)
+	}
+	if got := readRepoFile(t, h.d, deployment); !strings.Contains(got, "namespace: applications\n") {
+		t.Fatalf("dry run changed Git:\n%s", got)
+	}
+
+	h.call("set-exposure", map[string]interface{}{"app_name": "api", "exposure": exposureLocal}, false)
+	got := readRepoFile(t, h.d, deployment)
+	if !strings.Contains(got, "namespace: applications-local\n") || !strings.Contains(got, "replicas: 2") {
+		t.Fatalf("deployment not moved with its manual edit:\n%s", got)
+	}
+	if app := readRepoFile(t, h.d, "argocd-apps/api.yaml"); !strings.Contains(app, "namespace: applications-local\n") {
+		t.Fatalf("application not moved:\n%s", app)
+	}
+	if readRepoFile(t, h.d, npApp) == "" {
+		t.Fatal("local network policy not bootstrapped")
+	}
+	if out := h.call("set-exposure", map[string]interface{}{"app_name": "api", "exposure": exposureLocal}, false); !strings.Contains(out, "already deployed in namespace applications-local") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+
+	// Upgrades in the new namespace still merge the manual edit.
+	h.call("deploy-image", map[string]interface{}{"app_name": "api", "image": "nginx:1.28", "exposure": exposureLocal, "mode": modeUpgrade}, false)
+	if got := readRepoFile(t, h.d, deployment); !strings.Contains(got, "replicas: 2") || !strings.Contains(got, "nginx:1.28") {
+		t.Fatalf("upgrade after the move lost the manual edit:\n%s", got)
+	}
+
+	// The tool reports what ArgoCD has not pruned from the old namespace.
+	h.d.kube.AppsV1().Deployments("applications-local").Create(context.Background(), &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "applications-local", Labels: map[string]string{"app": "api"}},
+	}, metav1.CreateOptions{})
+	h.d.argoTimeout = 50 * time.Millisecond
+	out = h.call("set-exposure", map[string]interface{}{"app_name": "api", "exposure": exposurePublic}, true)
+	if !strings.Contains(out, "Git updated but ArgoCD has not pruned api from namespace applications-local") || !strings.Contains(out, "Deployment/api") {
+		t.Fatalf("unexpected error:\n%s", out)
+	}
+	if got := readRepoFile(t, h.d, deployment); !strings.Contains(got, "namespace: applications\n") {
+		t.Fatalf("deployment not moved back:\n%s", got)
+	}
+	if readRepoFile(t, h.d, npApp) != "" {
+		t.Fatal("local network policy kept without local apps")
+	}
+
+	h.d.cfg.LocalAllowedSubnets = nil
+	if out := h.call("set-exposure", map[string]interface{}{"app_name": "api", "exposure": exposureLocal}, true); !strings.Contains(out, "--local-allowed-subnets must be set") {
+		t.Fatalf("unexpected error:\n%s", out)
+	}
+	if out := h.call("set-exposure", map[string]interface{}{"app_name": "api", "exposure": exposureNone}, true); !strings.Contains(out, `exposure must be "public" or "local"`) {
+		t.Fatalf("unexpected error:\n%s", out)
+	}
+
+	// Authentication is removed by an upgrade, not by set-exposure.
+	h.call("deploy-image", map[string]interface{}{"app_name": "admin", "image": "nginx:1.27", "exposure": exposureAuthenticated}, false)
+	out = h.call("set-exposure", map[string]interface{}{"app_name": "admin", "exposure": exposurePublic}, true)
+	if !strings.Contains(out, "with exposure=authenticated") || !strings.Contains(out, "deploy-image mode=upgrade exposure=public") {
+		t.Fatalf("unexpected error:\n%s", out)
+	}
+	h.d.cfg.LocalAllowedSubnets = stringList{"192.168.0.0/16"}
+	out = h.call("set-exposure", map[string]interface{}{"app_name": "admin", "exposure": exposureLocal}, true)
+	if !strings.Contains(out, "cannot be moved to exposure=local with its authentication") {
+		t.Fatalf("unexpected error:\n%s", out)
+	}
+	if app := readRepoFile(t, h.d, "argocd-apps/admin.yaml"); !strings.Contains(app, "namespace: applications\n") {
+		t.Fatalf("authenticated app moved:\n%s", app)
+	}
+}
@@ -7,23 +7,18 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-git/go-git/v5"
-	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/mark3labs/mcp-go/mcp"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
-func status(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
+func (d *Deployer) status(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
 	result := []string{fmt.Sprintf("Status for application: %s", appName)}
 
 	// 1. Check Git Status
-	existsInGit, err := checkGitStatus(appName)
+	existsInGit, err := d.checkGitStatus(ctx, appName)
 	if err != nil {
 		result = append(result, fmt.Sprintf("Error checking git: %v", err))
 	} else if existsInGit {
@@ -36,70 +31,60 @@ func status(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
 	// We'll look for the Application CR in the "argocd" namespace (or wherever ArgoCD is installed)
 	// The user didn't specify ArgoCD namespace, but conventionally it is `argocd`.
 	// The spec says "Wait for expected ArgoCD application to appear in Kubernetes cluster"
-	argocdStatus, err := checkArgoStatus(ctx, appName)
+	argocdStatus, err := d.checkArgoStatus(ctx, appName)
 	if err != nil {
 		result = append(result, fmt.Sprintf("Error checking ArgoCD: %v", err))
 	} else {
 		result = append(result, argocdStatus)
 	}
 
-	// 3. Check Ingress Reachability
-	host := fmt.Sprintf("%s.%s", appName, domain)
-	ingressURL, reachable := firstReachableIngressURL(host)
-	if reachable {
+	// 3. Check Ingress Reachability, or the runs of CronJobs and Jobs, which
+	// have no Ingress
+	host := d.appHost(appName)
+	existing := d.headApp(ctx, appName)
+	if existing != nil && (existing.Source == sourceCronJob || existing.Source == sourceJob) {
+		result = append(result, d.jobStatus(ctx, appName, existing.Namespace, existing.Source)...)
+	} else if existing != nil && !existing.HasIngress {
+		result = append(result, "➖ No Ingress (exposure=none or worker); reachability not checked")
+	} else if ingressURL, reachable := d.firstReachableIngressURL(host+existing.probePath(), existing != nil && existing.Auth != ""); reachable {
 		result = append(result, fmt.Sprintf("✅ Ingress reachable: %s", ingressURL))
 	} else {
 		result = append(result, fmt.Sprintf("❌ Ingress unreachable: %s", host))
 	}
+	if existing != nil && existing.HasIngress && existing.TLS {
+		result = append(result, d.certificateStatus(ctx, existing.Namespace, host))
+	}
 
 	return mcp.NewToolResultText(strings.Join(result, "\n")), nil
 }
 
-func checkGitStatus(appName string) (bool, error) {
-	// We use an in-memory clone for speed, just checking existence
-	auth := &githttp.BasicAuth{
-		Username: "oauth2",
-		Password: githubToken,
-	}
-
-	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
-		URL:   githubURL,
-		Auth:  auth,
-		Depth: 1,
-	})
-	if err != nil {
-		return false, err
-	}
-
-	// Check if manifest file exists in the HEAD
-	ref, err := r.Head()
-	if err != nil {
-		return false, err
-	}
-
-	commit, err := r.CommitObject(ref.Hash())
-	if err != nil {
-		return false, err
-	}
-
-	tree, err := commit.Tree()
+func (d *Deployer) checkGitStatus(ctx context.Context, appName string) (bool, error) {
+	tree, err := d.repo.HeadTree(ctx)
 	if err != nil {
 		return false, err
 	}
 
 	// Check for application.yaml in argo path
-	argoPath := fmt.Sprintf("%s/%s.yaml", argocdAppPath, appName)
-	_, err = tree.File(argoPath)
+	_, err = tree.File(d.argoAppFile(appName))
 	return err == nil, nil
 }
 
-func checkArgoStatus(ctx context.Context, appName string) (string, error) {
-	dynClient, err := newDynamicClient()
+// headApp describes appName as committed at HEAD, or returns nil if it is
+// not deployed or cannot be read.
+func (d *Deployer) headApp(ctx context.Context, appName string) *existingApp {
+	tree, err := d.repo.HeadTree(ctx)
+	if err != nil {
+		return nil
+	}
+	existing, err := d.readExistingApp(treeFiles{tree}, appName)
 	if err != nil {
-		return "", err
+		return nil
 	}
+	return existing
+}
 
-	app, err := getArgoApplication(ctx, dynClient, appName)
+func (d *Deployer) checkArgoStatus(ctx context.Context, appName string) (string, error) {
+	app, err := d.getArgoApplication(ctx, appName)
 	if err != nil {
 		return fmt.Sprintf("❌ ArgoCD Application not found: %v", err), nil
 	}
@@ -113,31 +98,17 @@ func checkArgoStatus(ctx context.Context, appName string) (string, error) {
 	return "⚠️ ArgoCD App found but status unknown", nil
 }
 
-func newDynamicClient() (dynamic.Interface, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
-	if err != nil {
-		return nil, err
-	}
-
-	return dynamic.NewForConfig(config)
-}
-
-func getArgoApplication(ctx context.Context, dynClient dynamic.Interface, appName string) (*unstructured.Unstructured, error) {
+func (d *Deployer) getArgoApplication(ctx context.Context, appName string) (*unstructured.Unstructured, error) {
 	gvr := schema.GroupVersionResource{
 		Group:    "argoproj.io",
 		Version:  "v1alpha1",
 		Resource: "applications",
 	}
 
-	return dynClient.Resource(gvr).Namespace("argocd").Get(ctx, appName, metav1.GetOptions{})
+	return d.dyn.Resource(gvr).Namespace("argocd").Get(ctx, appName, metav1.GetOptions{})
 }
 
-func waitForArgoApplicationHealthy(ctx context.Context, appName string, timeout, interval time.Duration) error {
-	dynClient, err := newDynamicClient()
-	if err != nil {
-		return err
-	}
-
+func (d *Deployer) waitForArgoApplicationHealthy(ctx context.Context, appName string, timeout, interval time.Duration) error {
 	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -147,7 +118,7 @@ func waitForArgoApplicationHealthy(ctx context.Context, appName string, timeout,
 	var lastState string
 
 	for {
-		app, err := getArgoApplication(deadlineCtx, dynClient, appName)
+		app, err := d.getArgoApplication(deadlineCtx, appName)
 		switch {
 		case err == nil:
 			healthStatus, _, _ := unstructured.NestedString(app.Object, "status", "health", "status")
@@ -170,22 +141,32 @@ func waitForArgoApplicationHealthy(ctx context.Context, appName string, timeout,
 	}
 }
 
-func checkReachability(url string) bool {
-	client := http.Client{
-		Timeout: 5 * time.Second,
+// checkReachability reports whether url answers with a success or a
+// redirect. An app behind authentication (authenticated) is reachable when
+// it asks for credentials with a 401 or redirects to its sign-in page, which
+// is not followed.
+func (d *Deployer) checkReachability(url string, authenticated bool) bool {
+	client := d.httpClient
+	if authenticated {
+		noRedirects := *d.httpClient
+		noRedirects.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+		client = &noRedirects
 	}
 	resp, err := client.Get(url)
 	if err != nil {
 		return false
 	}
 	defer resp.Body.Close()
+	if authenticated && resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
 	return resp.StatusCode >= 200 && resp.StatusCode < 400
 }
 
-func firstReachableIngressURL(host string) (string, bool) {
+func (d *Deployer) firstReachableIngressURL(host string, authenticated bool) (string, bool) {
 	for _, scheme := range []string{"https://", "http://"} {
 		url := scheme + host
-		if checkReachability(url) {
+		if d.checkReachability(url, authenticated) {
 			return url, true
 		}
 	}
@@ -193,7 +174,7 @@ func firstReachableIngressURL(host string) (string, bool) {
 	return "https://" + host, false
 }
 
-func waitForIngressReachability(ctx context.Context, host string, timeout, interval time.Duration) error {
+func (d *Deployer) waitForIngressReachability(ctx context.Context, host string, authenticated bool, timeout, interval time.Duration) error {
 	deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -201,7 +182,7 @@ func waitForIngressReachability(ctx context.Context, host string, timeout, inter
 	defer ticker.Stop()
 
 	for {
-		if _, ok := firstReachableIngressURL(host); ok {
+		if _, ok := d.firstReachableIngressURL(host, authenticated); ok {
 			return nil
 		}
 
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed templates/*
+var templatesFS embed.FS
+
+// imageAppTemplates are the built-in templates rendered into
+// manifests/<app>/ for every image app.
+var imageAppTemplates = []string{"deployment.yaml", "service.yaml", "ingress.yaml"}
+
+// loadTemplates returns the templates to render with: the embedded ones,
+// overlaid by the files in dir if it is set. A file in dir named like a
+// built-in template replaces it; any other *.yaml file is an extra template,
+// rendered for every image app next to the built-in manifests and returned
+// in extra, unless a profile lists it (see withoutProfileTemplates). Every
+// template in dir is parsed up front so that mistakes are reported at
+// startup.
+func loadTemplates(dir string) (fsys fs.FS, extra []string, err error) {
+	if dir == "" {
+		return templatesFS, nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read templates-dir: %w", err)
+	}
+	fsys = overlayFS{upper: prefixFS{prefix: "templates/", fsys: os.DirFS(dir)}, lower: templatesFS}
+
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || (path.Ext(name) != ".yaml" && path.Ext(name) != ".yml") {
+			continue
+		}
+		if _, err := parseTemplate(fsys, "templates/"+name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := fs.Stat(templatesFS, "templates/"+name); errors.Is(err, fs.ErrNotExist) {
+			extra = append(extra, name)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, fmt.Errorf("templates-dir %s: %w", dir, err)
+	}
+	slices.Sort(extra)
+	return fsys, extra, nil
+}
+
+func parseTemplate(fsys fs.FS, templatePath string) (*template.Template, error) {
+	tmpl, err := template.New(path.Base(templatePath)).Funcs(templateFuncs).ParseFS(fsys, templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", templatePath, err)
+	}
+	return tmpl, nil
+}
+
+// overlayFS serves files from upper, falling back to lower.
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.lower.Open(name)
+	}
+	return f, err
+}
+
+// prefixFS makes fsys appear under prefix.
+type prefixFS struct {
+	prefix string
+	fsys   fs.FS
+}
+
+func (p prefixFS) Open(name string) (fs.File, error) {
+	rel, ok := strings.CutPrefix(name, p.prefix)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return p.fsys.Open(rel)
+}
+
+// templateFuncs is the function set available to every template, a subset of
+// the sprig functions familiar from Helm charts. Keep the README in sync.
+var templateFuncs = template.FuncMap{
+	"default": func(def, v interface{}) interface{} {
+		if isEmpty(v) {
+			return def
+		}
+		return v
+	},
+	"required": func(msg string, v interface{}) (interface{}, error) {
+		if v == nil || v == "" {
+			return nil, errors.New(msg)
+		}
+		return v, nil
+	},
+	"quote":      func(v interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(v)) },
+	"squote":     func(v interface{}) string { return "'" + strings.ReplaceAll(fmt.Sprint(v), "'", "''") + "'" },
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"trunc": func(n int, s string) string {
+		if len(s) > n {
+			return s[:n]
+		}
+		return s
+	},
+	"join":  func(sep string, items []string) string { return strings.Join(items, sep) },
+	"split": func(sep, s string) []string { return strings.Split(s, sep) },
+	"list":  func(items ...interface{}) []interface{} { return items },
+	"dict": func(kv ...interface{}) (map[string]interface{}, error) {
+		if len(kv)%2 != 0 {
+			return nil, errors.New("dict needs an even number of arguments")
+		}
+		m := make(map[string]interface{}, len(kv)/2)
+		for i := 0; i < len(kv); i += 2 {
+			m[fmt.Sprint(kv[i])] = kv[i+1]
+		}
+		return m, nil
+	},
+	"indent": indent,
+	"nindent": func(n int, s string) string {
+		return "\n" + indent(n, s)
+	},
+	"toYaml": func(v interface{}) (string, error) {
+		out, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(out), "\n"), err
+	},
+	"toJson": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	"b64enc": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"sha256sum": func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	},
+}
+
+// isEmpty reports whether v is empty as sprig's default sees it: nil, the
+// zero value of a scalar of any type, such as int64 or float64 from decoded
+// values, or a collection without elements.
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Array, reflect.Chan, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
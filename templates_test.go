@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestTemplatesDirOverridesAndExtends(t *testing.T) {
+	service, err := templatesFS.ReadFile("templates/service.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	overridden := strings.Replace(string(service), "  name: {{ .Name }}\n", "  name: {{ .Name }}\n  labels:\n    team: {{ \"platform\" | upper | lower | quote }}\n", 1)
+	dir := writeTemplates(t, map[string]string{
+		"service.yaml": overridden,
+		"pdb.yaml": `apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Name }}
+  namespace: {{ .Namespace }}
+  annotations: {{- dict "image" .Image "hash" (sha256sum .Image | trunc 8) | toYaml | nindent 4 }}
+spec:
+  maxUnavailable: 1
+  selector:
+    matchLabels:
+      app: {{ .Name }}
+`,
+		"README.md": "not a template",
+	})
+
+	fsys, extra, err := loadTemplates(dir)
+	if err != nil {
+		t.Fatalf("loadTemplates returned error: %v", err)
+	}
+	if !slices.Equal(extra, []string{"pdb.yaml"}) {
+		t.Fatalf("extra templates = %v", extra)
+	}
+
+	d, _ := newTestDeployer(t, nil)
+	d.templates, d.extraTemplates = fsys, extra
+	res, err := d.deploy(context.Background(), deployRequest{AppName: "demo", Exposure: exposurePublic, Namespace: d.cfg.Namespace}, "nginx:1.27")
+	if err != nil || res.IsError {
+		t.Fatalf("deploy failed: %v %s", err, resultText(res))
+	}
+
+	if svc := readRepoFile(t, d, "manifests/demo/service.yaml"); !strings.Contains(svc, `team: "platform"`) {
+		t.Fatalf("service template not overridden:\n%s", svc)
+	}
+	pdb := readRepoFile(t, d, "manifests/demo/pdb.yaml")
+	if !strings.Contains(pdb, "kind: PodDisruptionBudget") || !strings.Contains(pdb, "    image: nginx:1.27\n") || !strings.Contains(pdb, "    hash: ") {
+		t.Fatalf("unexpected extra manifest:\n%s", pdb)
+	}
+	if deployment := readRepoFile(t, d, "manifests/demo/deployment.yaml"); !strings.Contains(deployment, "image: nginx:1.27") {
+		t.Fatalf("built-in deployment template not used:\n%s", deployment)
+	}
+}
+
+func TestLoadTemplatesRejectsInvalidTemplates(t *testing.T) {
+	if _, _, err := loadTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing templates-dir accepted")
+	}
+
+	dir := writeTemplates(t, map[string]string{
+		"broken.yaml":  "name: {{ .Name",
+		"unknown.yaml": "name: {{ .Name | frobnicate }}",
+	})
+	_, _, err := loadTemplates(dir)
+	if err == nil {
+		t.Fatal("invalid templates accepted")
+	}
+	for _, want := range []string{"broken.yaml", "frobnicate"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestDefaultTreatsZeroValuesAsEmpty(t *testing.T) {
+	def := templateFuncs["default"].(func(def, v interface{}) interface{})
+	tests := []struct {
+		name string
+		v    interface{}
+		want interface{}
+	}{
+		{"nil", nil, "def"},
+		{"empty string", "", "def"},
+		{"false", false, "def"},
+		{"int zero", 0, "def"},
+		{"int64 zero", int64(0), "def"},
+		{"float64 zero", float64(0), "def"},
+		{"empty slice", []interface{}{}, "def"},
+		{"empty map", map[string]interface{}{}, "def"},
+		{"string", "x", "x"},
+		{"true", true, true},
+		{"int", 3, 3},
+		{"int64", int64(-1), int64(-1)},
+		{"float64", 0.5, 0.5},
+		{"slice", []interface{}{1}, []interface{}{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := def("def", tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("default(%q, %#v) = %#v, want %#v", "def", tt.v, got, tt.want)
+			}
+		})
+	}
+}
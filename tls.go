@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// certificateGVR is cert-manager's Certificate, which its ingress-shim
+// creates for every Ingress carrying a cluster-issuer annotation.
+var certificateGVR = schema.GroupVersionResource{
+	Group:    "cert-manager.io",
+	Version:  "v1",
+	Resource: "certificates",
+}
+
+// tlsIssuer returns the ClusterIssuer for the Ingress of the app in req, or
+// "" if it is served over plain HTTP.
+func (d *Deployer) tlsIssuer(req deployRequest) (string, error) {
+	switch {
+	case req.Exposure == exposureNone:
+		return "", nil
+	case req.TLS == nil:
+		return d.cfg.TLSIssuer, nil
+	case !*req.TLS:
+		return "", nil
+	case d.cfg.TLSIssuer == "":
+		return "", errors.New("tls requires the server to be started with --tls-issuer")
+	}
+	return d.cfg.TLSIssuer, nil
+}
+
+// certificateStatus reports whether the cert-manager Certificate covering
+// host in namespace is ready, and when it expires.
+func (d *Deployer) certificateStatus(ctx context.Context, namespace, host string) string {
+	certs, err := d.dyn.Resource(certificateGVR).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Sprintf("❌ TLS certificate for %s: %v", host, err)
+	}
+
+	for _, cert := range certs.Items {
+		dnsNames, _, _ := unstructured.NestedStringSlice(cert.Object, "spec", "dnsNames")
+		if !slices.Contains(dnsNames, host) {
+			continue
+		}
+
+		ready, message := certificateReady(&cert)
+		if !ready {
+			return fmt.Sprintf("❌ TLS certificate %s not ready: %s", cert.GetName(), message)
+		}
+		notAfter, _, _ := unstructured.NestedString(cert.Object, "status", "notAfter")
+		expiry, err := time.Parse(time.RFC3339, notAfter)
+		if err != nil {
+			return fmt.Sprintf("✅ TLS certificate %s ready, expiry unknown", cert.GetName())
+		}
+		days := int(time.Until(expiry).Hours() / 24)
+		if days < 14 {
+			return fmt.Sprintf("⚠️ TLS certificate %s ready, expires %s (in %d days)", cert.GetName(), notAfter, days)
+		}
+		return fmt.Sprintf("✅ TLS certificate %s ready, expires %s (in %d days)", cert.GetName(), notAfter, days)
+	}
+	return fmt.Sprintf("⏳ No cert-manager Certificate for %s in namespace %s yet", host, namespace)
+}
+
+// certificateReady returns the state of a Certificate's Ready condition.
+func certificateReady(cert *unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, _ := c.(map[string]interface{})
+		if cond["type"] != "Ready" {
+			continue
+		}
+		message, _ := cond["message"].(string)
+		return cond["status"] == "True", message
+	}
+	return false, "no Ready condition yet"
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTLS(t *testing.T) {
+	h := newHarness(t)
+
+	out := h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.27", "tls": true}, true)
+	if !strings.Contains(out, "--tls-issuer") {
+		t.Fatalf("tls without an issuer: %s", out)
+	}
+
+	h.d.cfg.TLSIssuer = "letsencrypt"
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.27"}, false)
+	ingress := readRepoFile(t, h.d, "manifests/web/ingress.yaml")
+	for _, want := range []string{`cert-manager.io/cluster-issuer: "letsencrypt"`, "secretName: web-tls", "- web.example.com"} {
+		if !strings.Contains(ingress, want) {
+			t.Errorf("ingress lacks %q:\n%s", want, ingress)
+		}
+	}
+
+	out = h.call("status", map[string]interface{}{"app_name": "web"}, false)
+	if !strings.Contains(out, "⏳ No cert-manager Certificate for web.example.com") {
+		t.Fatalf("status before the certificate exists:\n%s", out)
+	}
+
+	notAfter := time.Now().Add(60 * 24 * time.Hour).UTC().Format(time.RFC3339)
+	cert := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata":   map[string]interface{}{"name": "web-tls", "namespace": h.d.cfg.Namespace},
+		"spec":       map[string]interface{}{"dnsNames": []interface{}{"web.example.com"}, "secretName": "web-tls"},
+		"status": map[string]interface{}{
+			"notAfter":   notAfter,
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": "True"}},
+		},
+	}}
+	if _, err := h.d.dyn.Resource(certificateGVR).Namespace(h.d.cfg.Namespace).Create(context.Background(), cert, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	out = h.call("status", map[string]interface{}{"app_name": "web"}, false)
+	if !strings.Contains(out, "✅ TLS certificate web-tls ready, expires "+notAfter) {
+		t.Fatalf("status with a ready certificate:\n%s", out)
+	}
+
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.27", "tls": false, "mode": modeUpgrade}, false)
+	ingress = readRepoFile(t, h.d, "manifests/web/ingress.yaml")
+	if strings.Contains(ingress, "cert-manager") || strings.Contains(ingress, "tls:") {
+		t.Fatalf("tls=false kept TLS:\n%s", ingress)
+	}
+	if out := h.call("status", map[string]interface{}{"app_name": "web"}, false); strings.Contains(out, "TLS certificate") {
+		t.Fatalf("status reported a certificate for a plain HTTP app:\n%s", out)
+	}
+
+	// Upgrades without tls keep the app's current setting, either way.
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.28", "mode": modeUpgrade}, false)
+	if ingress := readRepoFile(t, h.d, "manifests/web/ingress.yaml"); strings.Contains(ingress, "tls:") {
+		t.Fatalf("upgrade without tls turned TLS back on:\n%s", ingress)
+	}
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.28", "tls": true, "mode": modeUpgrade}, false)
+	h.call("deploy-image", map[string]interface{}{"app_name": "web", "image": "nginx:1.29", "mode": modeUpgrade}, false)
+	if ingress := readRepoFile(t, h.d, "manifests/web/ingress.yaml"); !strings.Contains(ingress, "secretName: web-tls") {
+		t.Fatalf("upgrade without tls dropped TLS:\n%s", ingress)
+	}
+}
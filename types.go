@@ -35,19 +35,82 @@ type ArgoAppConfig struct {
 }
 
 type ImageManifestData struct {
+	Ownership
 	Name         string
 	Image        string
 	Namespace    string
 	Domain       string
 	RepoURL      string
 	ManifestPath string
+	Profile      string
+	// Params are the profile parameters, with schema defaults filled in.
+	Params map[string]interface{}
+	// TLSIssuer is the cert-manager ClusterIssuer for the Ingress's
+	// certificate; empty serves the app over plain HTTP.
+	TLSIssuer string
+	// IngressClass is the Ingress's ingressClassName; empty uses the
+	// cluster default.
+	IngressClass string
+	// Aliases are hostnames served besides <Name>.<Domain>, and Path the
+	// prefix routed to the app on each of them ("/" when empty).
+	Aliases            []string
+	Path               string
+	IngressAnnotations map[string]string
+	// AllowedCIDRs, when set, restrict who may reach the app's pods with an
+	// app-scoped NetworkPolicy, and its Ingress with AllowlistAnnotation
+	// when that is set.
+	AllowedCIDRs        []string
+	AllowlistAnnotation string
+	// BasicAuth is the htpasswd entry of an app with auth=basic.
+	BasicAuth string
+}
+
+// Hosts returns every hostname of the app's Ingress: <Name>.<Domain> first,
+// then the aliases.
+func (d ImageManifestData) Hosts() []string {
+	return append([]string{d.Name + "." + d.Domain}, d.Aliases...)
+}
+
+// JobManifestData is rendered by the cronjob.yaml and job.yaml templates.
+type JobManifestData struct {
+	Ownership
+	Name      string
+	Image     string
+	Namespace string
+	Command   []string
+
+	// CronJob settings.
+	Schedule                   string
+	ConcurrencyPolicy          string
+	SuccessfulJobsHistoryLimit int
+	FailedJobsHistoryLimit     int
+
+	// Job settings. RunAt records when run-job was called, so that every call
+	// changes the Job and runs it again.
+	BackoffLimit int
+	RunAt        string
 }
 
 type ArgoApplicationData struct {
+	Ownership
 	Name      string
 	Namespace string
 	Git       *ArgoGitSource
 	Helm      *ArgoHelmSource
+	// Profile and Parameters (as JSON) are recorded for image apps deployed
+	// with a non-default profile or with parameters.
+	Profile    string
+	Parameters string
+	// HelmParameters are set on a Helm app after the deployer's own, e.g.
+	// the app's Ingress annotations.
+	HelmParameters []HelmParameter
+}
+
+// HelmParameter is a Helm value set by an ArgoCD Application, named as for
+// helm --set.
+type HelmParameter struct {
+	Name  string
+	Value string
 }
 
 type ArgoGitSource struct {
@@ -63,4 +126,9 @@ type ArgoHelmSource struct {
 	ReleaseName    string
 	IngressName    string
 	IngressHost    string
+	// TLSIssuer sets the chart's ingress.tls and cert-manager annotation
+	// values when not empty.
+	TLSIssuer string
+	// IngressClass sets the chart's ingress.ingressClassName value.
+	IngressClass string
 }
@@ -8,23 +8,27 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
-func update(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+func (d *Deployer) update(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
+	// Ownership and protection are recorded in Git; Helm charts do not carry
+	// them onto their Deployments.
+	tree, err := d.repo.HeadTree(ctx)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to build kubeconfig: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read repository: %v", err)), nil
 	}
-
-	clientset, err := kubernetes.NewForConfig(config)
+	existing, err := d.readExistingApp(treeFiles{tree}, appName)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to create Kubernetes client: %v", err)), nil
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to read app %s from Git: %v", appName, err)), nil
+	}
+	if existing != nil {
+		if err := existing.authorize(callerFrom(ctx), appName); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
 	}
 
 	// Get the current deployment. Search public namespace first, then local.
-	candidates := []string{namespace, localNamespace}
+	candidates := []string{d.cfg.Namespace, d.cfg.LocalNamespace}
 	var deploy *appsv1.Deployment
 	var foundNs string
 	var lastErr error
@@ -32,9 +36,9 @@ func update(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
 		if ns == "" {
 			continue
 		}
-		d, err := clientset.AppsV1().Deployments(ns).Get(ctx, appName, metav1.GetOptions{})
+		found, err := d.kube.AppsV1().Deployments(ns).Get(ctx, appName, metav1.GetOptions{})
 		if err == nil {
-			deploy = d
+			deploy = found
 			foundNs = ns
 			break
 		}
@@ -51,7 +55,7 @@ func update(ctx context.Context, appName string) (*mcp.CallToolResult, error) {
 	}
 	deploy.Spec.Template.ObjectMeta.Annotations["kubectl.kubernetes.io/restartedAt"] = time.Now().Format(time.RFC3339)
 
-	_, err = clientset.AppsV1().Deployments(foundNs).Update(ctx, deploy, metav1.UpdateOptions{})
+	_, err = d.kube.AppsV1().Deployments(foundNs).Update(ctx, deploy, metav1.UpdateOptions{})
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("Failed to update deployment %s: %v", appName, err)), nil
 	}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// cronMacros are the schedule shorthands accepted by CronJobs.
+var cronMacros = map[string]bool{
+	"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true,
+	"@daily": true, "@midnight": true, "@hourly": true,
+}
+
+// cronField matches one field of a five-field cron schedule: numbers, names,
+// *, ?, ranges, lists and steps.
+var cronField = regexp.MustCompile(`^[0-9A-Za-z*?,/-]+$`)
+
+// validateSchedule checks the shape of a CronJob schedule: a macro such as
+// @daily or five cron fields. The API server has the final say on values.
+func validateSchedule(schedule string) error {
+	fields := strings.Fields(schedule)
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "CRON_TZ=") || strings.HasPrefix(fields[0], "TZ=")) {
+		return fmt.Errorf("schedule %q must not set a time zone", schedule)
+	}
+	if len(fields) == 1 && cronMacros[fields[0]] {
+		return nil
+	}
+	if len(fields) != 5 {
+		return fmt.Errorf("schedule %q must have five fields (minute hour day-of-month month day-of-week) or be a macro such as @daily", schedule)
+	}
+	for _, f := range fields {
+		if !cronField.MatchString(f) {
+			return fmt.Errorf("schedule %q has an invalid field %q", schedule, f)
+		}
+	}
+	return nil
+}
+
+// reservedAppNames are ArgoCD Applications managed by the deployer itself
+// that no tool may create, replace or remove on a caller's behalf.
+var reservedAppNames = map[string]bool{
+	localNetworkPolicyAppName: true,
+}
+
+// validateAppName checks that name can be used verbatim as a Kubernetes
+// object name (including a Service, which must be a DNS-1035 label), as a
+// single path segment in the GitOps repository, and as the first label of
+// the <app>.<domain> ingress host.
+func validateAppName(name, domain string) error {
+	if name == "" {
+		return fmt.Errorf("app_name must not be empty")
+	}
+	if strings.ContainsAny(name, `/\`) || strings.Contains(name, "..") {
+		return fmt.Errorf("app_name %q must not contain path separators or '..'", name)
+	}
+	if msgs := validation.IsDNS1035Label(name); len(msgs) > 0 {
+		return fmt.Errorf("app_name %q is invalid: %s", name, strings.Join(msgs, "; "))
+	}
+	if reservedAppNames[name] {
+		return fmt.Errorf("app_name %q is reserved for use by the deployer", name)
+	}
+	host := name + "." + domain
+	if msgs := validation.IsDNS1123Subdomain(host); len(msgs) > 0 {
+		return fmt.Errorf("app_name %q gives invalid ingress host %q: %s", name, host, strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// imageReference is a parsed container image reference.
+type imageReference struct {
+	// Registry is the registry host (with port, if any). Docker Hub
+	// references without an explicit registry get "docker.io".
+	Registry string
+	// Repository is the path within the registry, e.g. "library/nginx".
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// String returns the fully qualified reference.
+func (r imageReference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// The grammar follows github.com/distribution/reference.
+var (
+	imageDomainRe    = regexp.MustCompile(`^(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?$`)
+	imageComponentRe = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	imageTagRe       = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigestRe    = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}$`)
+)
+
+const defaultImageRegistry = "docker.io"
+
+// parseImageReference parses [registry[:port]/]path[:tag][@digest].
+func parseImageReference(image string) (*imageReference, error) {
+	if image == "" {
+		return nil, fmt.Errorf("image must not be empty")
+	}
+	if len(image) > 255 {
+		return nil, fmt.Errorf("image reference is longer than 255 characters")
+	}
+
+	ref := &imageReference{}
+	rest := image
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Digest = rest[i+1:]
+		rest = rest[:i]
+		if !imageDigestRe.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("image %q has invalid digest %q", image, ref.Digest)
+		}
+	}
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+		if !imageTagRe.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("image %q has invalid tag %q", image, ref.Tag)
+		}
+	}
+
+	components := strings.Split(rest, "/")
+	if len(components) > 1 && (strings.ContainsAny(components[0], ".:") || components[0] == "localhost") {
+		ref.Registry = components[0]
+		components = components[1:]
+		if !imageDomainRe.MatchString(ref.Registry) {
+			return nil, fmt.Errorf("image %q has invalid registry %q", image, ref.Registry)
+		}
+	} else {
+		ref.Registry = defaultImageRegistry
+	}
+	// Docker Hub spells the same image nginx, docker.io/nginx,
+	// index.docker.io/nginx and docker.io/library/nginx.
+	if ref.Registry == "index."+defaultImageRegistry {
+		ref.Registry = defaultImageRegistry
+	}
+	if ref.Registry == defaultImageRegistry && len(components) == 1 {
+		components = append([]string{"library"}, components...)
+	}
+
+	for _, c := range components {
+		if !imageComponentRe.MatchString(c) {
+			return nil, fmt.Errorf("image %q has invalid repository component %q (must be lowercase alphanumerics separated by '.', '_', '__' or '-')", image, c)
+		}
+	}
+	ref.Repository = strings.Join(components, "/")
+
+	return ref, nil
+}
+
+// appNameArg extracts and validates the app_name argument shared by every
+// tool.
+func (d *Deployer) appNameArg(args map[string]interface{}) (string, error) {
+	appName, ok := args["app_name"].(string)
+	if !ok {
+		return "", fmt.Errorf("app_name must be a string")
+	}
+	if err := validateAppName(appName, d.cfg.Domain); err != nil {
+		return "", err
+	}
+	return appName, nil
+}
+
+// boolArg returns an optional boolean argument, defaulting to false.
+func boolArg(args map[string]interface{}, name string) (bool, error) {
+	b, err := optionalBoolArg(args, name)
+	if b == nil {
+		return false, err
+	}
+	return *b, nil
+}
+
+// optionalBoolArg returns an optional boolean argument, or nil if it was not
+// given.
+func optionalBoolArg(args map[string]interface{}, name string) (*bool, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	b, ok := raw.(bool)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a boolean", name)
+	}
+	return &b, nil
+}
+
+// intArg returns an optional integer argument between min and max,
+// defaulting to def.
+func intArg(args map[string]interface{}, name string, def, min, max int) (int, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return def, nil
+	}
+	f, ok := raw.(float64)
+	if !ok || f != float64(int(f)) {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	n := int(f)
+	if n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+	return n, nil
+}
+
+// stringListArg returns an optional argument holding a list of strings.
+func stringListArg(args map[string]interface{}, name string) ([]string, error) {
+	raw, ok := args[name]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", name)
+	}
+	list := make([]string, len(items))
+	for i, item := range items {
+		if list[i], ok = item.(string); !ok {
+			return nil, fmt.Errorf("%s must be an array of strings", name)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAppName(t *testing.T) {
+	tests := []struct {
+		name    string
+		appName string
+		wantErr string
+	}{
+		{name: "valid", appName: "my-app-2"},
+		{name: "empty", appName: "", wantErr: "must not be empty"},
+		{name: "path traversal", appName: "../argocd-apps/evil", wantErr: "path separators"},
+		{name: "dot dot", appName: "a..b", wantErr: "path separators"},
+		{name: "uppercase", appName: "MyApp", wantErr: "is invalid"},
+		{name: "leading digit", appName: "1app", wantErr: "is invalid"},
+		{name: "too long", appName: strings.Repeat("a", 64), wantErr: "is invalid"},
+		{name: "reserved", appName: localNetworkPolicyAppName, wantErr: "reserved"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateAppName(test.appName, "example.com")
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, test.wantErr)
+			}
+		})
+	}
+
+	longDomain := strings.Repeat(strings.Repeat("d", 62)+".", 3) + strings.Repeat("e", 62)
+	if err := validateAppName("app", longDomain); err == nil || !strings.Contains(err.Error(), "invalid ingress host") {
+		t.Fatalf("expected ingress host length error, got %v", err)
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		image   string
+		want    imageReference
+		wantErr bool
+	}{
+		{image: "nginx", want: imageReference{Registry: "docker.io", Repository: "library/nginx"}},
+		{image: "nginx:1.27", want: imageReference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.27"}},
+		{image: "docker.io/nginx:1.27", want: imageReference{Registry: "docker.io", Repository: "library/nginx", Tag: "1.27"}},
+		{image: "index.docker.io/nginx", want: imageReference{Registry: "docker.io", Repository: "library/nginx"}},
+		{image: "user/app:latest", want: imageReference{Registry: "docker.io", Repository: "user/app", Tag: "latest"}},
+		{image: "ghcr.io/org/team/app:v1", want: imageReference{Registry: "ghcr.io", Repository: "org/team/app", Tag: "v1"}},
+		{image: "registry.local:5000/app", want: imageReference{Registry: "registry.local:5000", Repository: "app"}},
+		{image: "localhost/app@" + digest, want: imageReference{Registry: "localhost", Repository: "app", Digest: digest}},
+		{image: "", wantErr: true},
+		{image: "Nginx", wantErr: true},
+		{image: "nginx: latest", wantErr: true},
+		{image: "nginx:", wantErr: true},
+		{image: "app@sha256:abc", wantErr: true},
+		{image: "registry.local:5000/", wantErr: true},
+		{image: "ghcr.io/org//app", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			got, err := parseImageReference(test.image)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImageReference returned error: %v", err)
+			}
+			if *got != test.want {
+				t.Fatalf("got %+v want %+v", *got, test.want)
+			}
+		})
+	}
+}